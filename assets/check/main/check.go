@@ -5,27 +5,28 @@ import (
 	"errors"
 	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
 	"io"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"strconv"
+	"regexp"
+	"sort"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+	defaultMaxPages = 100
 )
 
 type CheckRequest struct {
-	Source shared.Source `json:"source"`
+	Source  shared.Source  `json:"source"`
+	Version shared.Version `json:"version"`
 }
 
 type CheckResponse []shared.Version
 
-type SonarResponse struct {
-	Analyses []Analyses `json:"analyses"`
-}
-
-type Analyses struct {
-	Key  string `json:"key"`
-	Date string `json:"date"`
+type Branch struct {
+	Name         string `json:"name"`
+	AnalysisDate string `json:"analysis_date,omitempty"`
 }
 
 func main() {
@@ -35,10 +36,7 @@ func main() {
 }
 
 func run(stdIn io.Reader, stdOut io.Writer) error {
-	var (
-		input    CheckRequest
-		response SonarResponse
-	)
+	var input CheckRequest
 	if err := json.NewDecoder(stdIn).Decode(&input); err != nil {
 		return err
 	}
@@ -47,54 +45,138 @@ func run(stdIn io.Reader, stdOut io.Writer) error {
 		return errors.New("mandatory field is missing")
 	}
 
-	result, err := getVersions(
-		input.Source.Target,
-		input.Source.SonarToken,
+	client, err := shared.NewClient(input.Source)
+	if err != nil {
+		return err
+	}
+
+	switch input.Source.Mode {
+	case "":
+	case shared.BranchesMode:
+		return checkBranches(client, input, stdOut)
+	default:
+		return errors.New("unknown mode " + input.Source.Mode)
+	}
+
+	analyses, err := getVersions(
+		client,
 		input.Source.Component,
+		input.Source.Branch,
+		input.Source.PullRequest,
+		input.Version.Date(),
+		input.Source.PageSize,
+		input.Source.MaxPages,
 	)
 	if err != nil {
 		return err
 	}
 
-	if err := json.Unmarshal(result, &response); err != nil {
-		return err
+	if input.Version.Analysis() != "" || input.Version.Date() != "" {
+		analyses, err = sinceCurrent(client, input.Source, analyses, input.Version)
+		if err != nil {
+			return err
+		}
 	}
 
 	var remoteVersions CheckResponse
-	for _, a := range response.Analyses {
-		remoteVersions = append([]shared.Version{{"timestamp": a.Date}}, remoteVersions...)
+	for _, a := range analyses {
+		remoteVersions = append([]shared.Version{a.Version()}, remoteVersions...)
 	}
 
 	return json.NewEncoder(stdOut).Encode(remoteVersions)
 }
 
-func getVersions(baseUrl string, authToken string, component string) ([]byte, error) {
-	fullUrl, err := url.Parse(baseUrl)
+// checkBranches emits a single version listing all matching branches with their
+// last analysis, so it changes whenever a branch is created, analysed or removed.
+func checkBranches(client *shared.Client, input CheckRequest, stdOut io.Writer) error {
+	include, err := regexp.Compile(input.Source.BranchInclude)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	var exclude *regexp.Regexp
+	if input.Source.BranchExclude != "" {
+		if exclude, err = regexp.Compile(input.Source.BranchExclude); err != nil {
+			return err
+		}
 	}
-	fullUrl.Path += "/api/project_analyses/search"
-	parameters := url.Values{}
-	parameters.Add("project", component)
-	fullUrl.RawQuery = parameters.Encode()
 
-	req, err := http.NewRequest(http.MethodGet, fullUrl.String(), nil)
+	response, err := client.ListBranches(input.Source.Component)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	req.SetBasicAuth(authToken, "")
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	branches := []Branch{}
+	for _, b := range response.Branches {
+		if !include.MatchString(b.Name) || (exclude != nil && exclude.MatchString(b.Name)) {
+			continue
+		}
+		branches = append(branches, Branch{Name: b.Name, AnalysisDate: b.AnalysisDate})
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	sort.Slice(branches, func(i, j int) bool {
+		return branches[i].Name < branches[j].Name
+	})
+
+	encoded, err := json.Marshal(branches)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	return json.NewEncoder(stdOut).Encode(CheckResponse{{"branches": string(encoded)}})
+}
+
+// sinceCurrent keeps the current analysis and everything newer.
+// When the current analysis is gone (e.g. removed by housekeeping),
+// only the latest analysis is returned.
+func sinceCurrent(client *shared.Client, source shared.Source, analyses []shared.Analysis, current shared.Version) ([]shared.Analysis, error) {
+	for i, a := range analyses {
+		if isCurrent(a, current) {
+			return analyses[:i+1], nil
+		}
+	}
+	if len(analyses) == 0 {
+		var err error
+		analyses, err = getVersions(client, source.Component, source.Branch, source.PullRequest, "", 1, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(analyses) == 0 {
+		return nil, nil
+	}
+	return analyses[:1], nil
+}
+
+// isCurrent matches versions without an analysis key by their date.
+func isCurrent(analysis shared.Analysis, current shared.Version) bool {
+	if current.Analysis() != "" {
+		return analysis.Key == current.Analysis()
+	}
+	return analysis.Date == current.Date()
+}
+
+// getVersions walks all pages of the project analyses, newest first,
+// and stops after maxPages to keep a check bounded on huge histories.
+func getVersions(client *shared.Client, component string, branch string, pullRequest string, from string, pageSize int, maxPages int) ([]shared.Analysis, error) {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
 	}
-	if resp.StatusCode != 200 {
-		return nil, errors.New("Status " + strconv.Itoa(resp.StatusCode) + " : " + string(body))
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	var analyses []shared.Analysis
+	for page := 1; page <= maxPages; page++ {
+		response, err := client.SearchAnalyses(component, branch, pullRequest, from, page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		analyses = append(analyses, response.Analyses...)
+
+		if len(response.Analyses) == 0 || page*pageSize >= response.Paging.Total {
+			break
+		}
 	}
-	return body, nil
+	return analyses, nil
 }
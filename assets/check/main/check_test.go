@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared/sharedtest"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -57,7 +58,7 @@ const (
 		    }
 		  ]
 		}`
-	suffix = "/api/project_analyses/search?project=my%3Acomponent"
+	suffix = "/api/project_analyses/search?p=1&project=my%3Acomponent&ps=100"
 )
 
 func TestReturnsVersionsOfLastResult(t *testing.T) {
@@ -96,7 +97,7 @@ func TestReturnsVersionsOfLastResult(t *testing.T) {
 		t.Error("Didn't call the remote service")
 	}
 
-	expectedResponse := `[{"timestamp":"2018-03-08T14:31:37+0100"},{"timestamp":"2018-03-22T15:15:48+0100"},{"timestamp":"2018-03-26T11:51:30+0200"},{"timestamp":"2018-04-04T15:32:28+0200"},{"timestamp":"2018-04-06T14:27:06+0200"}]`
+	expectedResponse := `[{"analysis":"AWIFz6Qd0iGqzMJL9y73","date":"2018-03-08T14:31:37+0100"},{"analysis":"AWJOESP5NZwlownmr1uo","date":"2018-03-22T15:15:48+0100"},{"analysis":"AWJhuKRVdrIzrRaH-JD8","date":"2018-03-26T11:51:30+0200"},{"analysis":"AWKQ3B6rdrIzrRaH-Rt3","date":"2018-04-04T15:32:28+0200"},{"analysis":"AWKa7VV9drIzrRaH-p_z","date":"2018-04-06T14:27:06+0200"}]`
 	response := make([]byte, len(expectedResponse), len(expectedResponse))
 	if _, err := stdout.Read(response); err != nil {
 		t.Error(err)
@@ -106,6 +107,334 @@ func TestReturnsVersionsOfLastResult(t *testing.T) {
 	}
 }
 
+func TestWalksAllPagesOfAnalyses(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	pages := map[string]string{
+		"1": `{"paging":{"pageIndex":1,"pageSize":2,"total":5},"analyses":[{"key":"e","date":"2018-04-06T14:27:06+0200"},{"key":"d","date":"2018-04-04T15:32:28+0200"}]}`,
+		"2": `{"paging":{"pageIndex":2,"pageSize":2,"total":5},"analyses":[{"key":"c","date":"2018-03-26T11:51:30+0200"},{"key":"b","date":"2018-03-22T15:15:48+0100"}]}`,
+		"3": `{"paging":{"pageIndex":3,"pageSize":2,"total":5},"analyses":[{"key":"a","date":"2018-03-08T14:31:37+0100"}]}`,
+	}
+	var requestedPages []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("p")
+		requestedPages = append(requestedPages, page)
+		if ps := r.URL.Query().Get("ps"); ps != "2" {
+			t.Errorf("Expected page size 2, but got %v", ps)
+		}
+		if _, err := w.Write([]byte(pages[page])); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"page_size": 2
+  			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if fmt.Sprint(requestedPages) != "[1 2 3]" {
+		t.Errorf("Expected pages [1 2 3] to be requested, but got %v", requestedPages)
+	}
+	expectedResponse := `[{"analysis":"a","date":"2018-03-08T14:31:37+0100"},{"analysis":"b","date":"2018-03-22T15:15:48+0100"},{"analysis":"c","date":"2018-03-26T11:51:30+0200"},{"analysis":"d","date":"2018-04-04T15:32:28+0200"},{"analysis":"e","date":"2018-04-06T14:27:06+0200"}]` + "\n"
+	if stdout.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdout.String())
+	}
+}
+
+func TestStopsAtMaxPages(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		response := fmt.Sprintf(`{"paging":{"pageIndex":%v,"pageSize":1,"total":1000},"analyses":[{"key":"k%v","date":"d%v"}]}`,
+			requests, requests, requests)
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"page_size": 1,
+    			"max_pages": 3
+  			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, but got %v", requests)
+	}
+	expectedResponse := `[{"analysis":"k3","date":"d3"},{"analysis":"k2","date":"d2"},{"analysis":"k1","date":"d1"}]` + "\n"
+	if stdout.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdout.String())
+	}
+}
+
+func TestReturnsCurrentAndNewerVersions(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if from := r.URL.Query().Get("from"); from != "2018-03-26T11:51:30+0200" {
+			t.Errorf("Expected from to be the current version, but got %v", from)
+		}
+		response := `{"paging":{"pageIndex":1,"pageSize":100,"total":3},"analyses":[
+			{"key":"e","date":"2018-04-06T14:27:06+0200"},
+			{"key":"d","date":"2018-04-04T15:32:28+0200"},
+			{"key":"c","date":"2018-03-26T11:51:30+0200"}]}`
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"analysis": "c",
+				"date": "2018-03-26T11:51:30+0200"
+			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+	expectedResponse := `[{"analysis":"c","date":"2018-03-26T11:51:30+0200"},{"analysis":"d","date":"2018-04-04T15:32:28+0200"},{"analysis":"e","date":"2018-04-06T14:27:06+0200"}]` + "\n"
+	if stdout.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdout.String())
+	}
+}
+
+func TestReturnsLatestVersionWhenCurrentWasDeleted(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := `{"paging":{"pageIndex":1,"pageSize":100,"total":2},"analyses":[
+			{"key":"e","date":"2018-04-06T14:27:06+0200"},
+			{"key":"d","date":"2018-04-04T15:32:28+0200"}]}`
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"timestamp": "2018-03-26T11:51:30+0200"
+			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	expectedResponse := `[{"analysis":"e","date":"2018-04-06T14:27:06+0200"}]` + "\n"
+	if stdout.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdout.String())
+	}
+}
+
+func TestFallsBackToLatestVersionWhenNothingIsNewer(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		response := `{"paging":{"pageIndex":1,"pageSize":100,"total":0},"analyses":[]}`
+		if r.URL.Query().Get("from") == "" {
+			response = `{"paging":{"pageIndex":1,"pageSize":1,"total":5},"analyses":[
+				{"key":"b","date":"2018-03-22T15:15:48+0100"}]}`
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"timestamp": "2018-03-26T11:51:30+0200"
+			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, but got %v", requests)
+	}
+	expectedResponse := `[{"analysis":"b","date":"2018-03-22T15:15:48+0100"}]` + "\n"
+	if stdout.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdout.String())
+	}
+}
+
+func TestEmitsProjectVersionAndRevision(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := `{"paging":{"pageIndex":1,"pageSize":100,"total":2},"analyses":[
+			{"key":"b","date":"2018-04-06T14:27:06+0200","projectVersion":"1.1.0","revision":"61cebf"},
+			{"key":"a","date":"2018-04-06T14:27:06+0200","projectVersion":"1.0.0","revision":"3f7a91"}]}`
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	expectedResponse := `[{"analysis":"a","date":"2018-04-06T14:27:06+0200","project_version":"1.0.0","revision":"3f7a91"},{"analysis":"b","date":"2018-04-06T14:27:06+0200","project_version":"1.1.0","revision":"61cebf"}]` + "\n"
+	if stdout.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdout.String())
+	}
+}
+
+func TestReturnsMatchingBranchesInBranchesMode(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		expected := "/api/project_branches/list?project=my%3Acomponent"
+		if r.URL.String() != expected {
+			t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+		}
+		response := `{"branches":[
+			{"name":"main","isMain":true,"type":"BRANCH","analysisDate":"2018-04-06T14:27:06+0200"},
+			{"name":"release/1.0","isMain":false,"type":"BRANCH","analysisDate":"2018-04-04T15:32:28+0200"},
+			{"name":"feature/wip","isMain":false,"type":"BRANCH","analysisDate":"2018-03-26T11:51:30+0200"},
+			{"name":"feature/login","isMain":false,"type":"BRANCH"}]}`
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"mode": "branches",
+    			"branch_include": "^(feature|release)/",
+    			"branch_exclude": "wip$"
+  			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+	expectedResponse := `[{"branches":"[{\"name\":\"feature/login\"},{\"name\":\"release/1.0\",\"analysis_date\":\"2018-04-04T15:32:28+0200\"}]"}]` + "\n"
+	if stdout.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdout.String())
+	}
+}
+
+func TestErrorsOnInvalidBranchFilter(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	stdin.WriteString(`{
+			"source": {
+    			"target": "https://my.sonar.server",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"mode": "branches",
+    			"branch_include": "("
+  			}
+		}`)
+
+	if err := run(stdin, stdout); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
+
+func TestErrorsOnUnknownMode(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	stdin.WriteString(`{
+			"source": {
+    			"target": "https://my.sonar.server",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"mode": "tags"
+  			}
+		}`)
+
+	err := run(stdin, stdout)
+	if err == nil || err.Error() != "unknown mode tags" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
+
 func TestRequestsTheCorrectUrl(t *testing.T) {
 	stdin := &bytes.Buffer{}
 	stdout := &bytes.Buffer{}
@@ -143,6 +472,115 @@ func TestRequestsTheCorrectUrl(t *testing.T) {
 	}
 }
 
+func TestRequestsAnalysesOfTheBranch(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		expected := "/api/project_analyses/search?branch=release%2F1.0&p=1&project=my%3Acomponent&ps=100"
+		if r.URL.String() != expected {
+			t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"branch": "release/1.0"
+  			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+}
+
+func TestRequestsAnalysesOfThePullRequest(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		expected := "/api/project_analyses/search?p=1&project=my%3Acomponent&ps=100&pullRequest=42"
+		if r.URL.String() != expected {
+			t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"pull_request": "42"
+  			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+}
+
+func TestPrefersPullRequestOverBranch(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		expected := "/api/project_analyses/search?p=1&project=my%3Acomponent&ps=100&pullRequest=42"
+		if r.URL.String() != expected {
+			t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"branch": "release/1.0",
+    			"pull_request": "42"
+  			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+}
+
 func TestAddsAuthenticationToTheRequest(t *testing.T) {
 	stdin := &bytes.Buffer{}
 	stdout := &bytes.Buffer{}
@@ -184,6 +622,97 @@ func TestAddsAuthenticationToTheRequest(t *testing.T) {
 	}
 }
 
+func TestAddsBearerTokenAndHeadersToTheRequest(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("Expected Bearer token, but got %v", auth)
+		}
+		if user := r.Header.Get("X-Forwarded-User"); user != "ci" {
+			t.Errorf("Expected custom header, but got %v", user)
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"auth_mode": "bearer",
+    			"headers": {"X-Forwarded-User": "ci"}
+  			}
+		}`, s.URL))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+}
+
+func TestTrustsCACertificateOfTheServer(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	var called bool
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdin.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"ca_cert": %q
+  			}
+		}`, s.URL, sharedtest.CertificatePEM(s.Certificate())))
+
+	if err := run(stdin, stdout); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+}
+
+func TestErrorsOnUnknownAuthMode(t *testing.T) {
+	stdin := &bytes.Buffer{}
+	stdout := &bytes.Buffer{}
+
+	stdin.WriteString(`{
+			"source": {
+    			"target": "https://my.sonar.server",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"auth_mode": "kerberos"
+  			}
+		}`)
+
+	err := run(stdin, stdout)
+	if err == nil || err.Error() != "unknown auth_mode kerberos" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
+
 func TestReturnsErrorIfContentCouldNotBeFetched(t *testing.T) {
 	stdin := &bytes.Buffer{}
 	stdout := &bytes.Buffer{}
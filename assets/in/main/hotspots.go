@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"net/url"
+)
+
+const hotspotsPageSize = 500
+
+type HotspotsParams struct {
+	Status     string `json:"status"`
+	Resolution string `json:"resolution"`
+}
+
+type Hotspots struct {
+	Total    int               `json:"total"`
+	Hotspots []json.RawMessage `json:"hotspots"`
+}
+
+func hotspotsQuery(component string, branch string, pullRequest string, params HotspotsParams) url.Values {
+	query := url.Values{}
+	query.Add("projectKey", component)
+	shared.AddBranchOrPullRequest(query, branch, pullRequest)
+	if params.Status != "" {
+		query.Add("status", params.Status)
+	}
+	if params.Resolution != "" {
+		query.Add("resolution", params.Resolution)
+	}
+	return query
+}
+
+func getAllHotspots(client *shared.Client, query url.Values) ([]byte, error) {
+	hotspots := []json.RawMessage{}
+	for page := 1; ; page++ {
+		response, err := client.SearchHotspots(query, page, hotspotsPageSize)
+		if err != nil {
+			return nil, err
+		}
+		hotspots = append(hotspots, response.Hotspots...)
+		if len(response.Hotspots) == 0 || page*hotspotsPageSize >= response.Paging.Total {
+			break
+		}
+	}
+	return json.Marshal(Hotspots{Total: len(hotspots), Hotspots: hotspots})
+}
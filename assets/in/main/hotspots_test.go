@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const hotspotsPath = "/api/hotspots/search"
+
+func TestWritesAllPagesOfHotspots(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	var pages []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != hotspotsPath {
+			if _, err := w.Write([]byte(mockResponse)); err != nil {
+				t.Error(err)
+			}
+			return
+		}
+		query := r.URL.Query()
+		pages = append(pages, query.Get("p"))
+		expected := map[string]string{
+			"projectKey": "my:component",
+			"branch":     "release/1.0",
+			"status":     "REVIEWED",
+			"resolution": "ACKNOWLEDGED",
+			"ps":         "500",
+		}
+		for k, v := range expected {
+			if query.Get(k) != v {
+				t.Errorf("Expected %v to be %v, but got %v", k, v, query.Get(k))
+			}
+		}
+		var hotspots []string
+		if query.Get("p") == "1" {
+			for i := 0; i < 500; i++ {
+				hotspots = append(hotspots, fmt.Sprintf(`{"key":"h%v"}`, i))
+			}
+		} else {
+			hotspots = append(hotspots, `{"key":"h500"}`)
+		}
+		response := fmt.Sprintf(`{"paging":{"pageIndex":%v,"pageSize":500,"total":501},"hotspots":[%v]}`,
+			query.Get("p"), strings.Join(hotspots, ","))
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"branch": "release/1.0"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"hotspots": {
+					"status": "REVIEWED",
+					"resolution": "ACKNOWLEDGED"
+				}
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(pages) != "[1 2]" {
+		t.Errorf("Expected pages [1 2] to be requested, but got %v", pages)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(tmpDir, "hotspots.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hotspots Hotspots
+	if err := json.Unmarshal(content, &hotspots); err != nil {
+		t.Fatal(err)
+	}
+	if hotspots.Total != 501 || len(hotspots.Hotspots) != 501 {
+		t.Errorf("Expected 501 hotspots, but got %v of %v", len(hotspots.Hotspots), hotspots.Total)
+	}
+}
+
+func TestReturnsErrorIfHotspotsCouldNotBeFetched(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == hotspotsPath {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"hotspots": {}
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err == nil {
+		t.Error("Expected error, but didn't error")
+	}
+}
@@ -3,36 +3,102 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+	"text/tabwriter"
 )
 
 type InRequest struct {
 	Source  shared.Source  `json:"source"`
 	Version shared.Version `json:"version"`
+	Params  InParams       `json:"params"`
+}
+
+type InParams struct {
+	PullRequest       string          `json:"pull_request"`
+	FailOnQualityGate bool            `json:"fail_on_quality_gate"`
+	FailOnWarning     bool            `json:"fail_on_warning"`
+	Thresholds        []string        `json:"thresholds"`
+	Issues            *IssuesParams   `json:"issues"`
+	Hotspots          *HotspotsParams `json:"hotspots"`
+}
+
+type Threshold struct {
+	Metric   string
+	Operator string
+	Value    string
+}
+
+var thresholdPattern = regexp.MustCompile(`^\s*([\w.:-]+)\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+
+func parseThreshold(rule string) (Threshold, error) {
+	match := thresholdPattern.FindStringSubmatch(rule)
+	if match == nil {
+		return Threshold{}, errors.New("invalid threshold " + rule)
+	}
+	return Threshold{Metric: match[1], Operator: match[2], Value: match[3]}, nil
+}
+
+// passes compares numerically and falls back to string equality for values like OK or ERROR.
+func (t Threshold) passes(actual string) bool {
+	a, errA := strconv.ParseFloat(actual, 64)
+	e, errE := strconv.ParseFloat(t.Value, 64)
+	if errA != nil || errE != nil {
+		switch t.Operator {
+		case "==":
+			return actual == t.Value
+		case "!=":
+			return actual != t.Value
+		}
+		return false
+	}
+	switch t.Operator {
+	case "<":
+		return a < e
+	case "<=":
+		return a <= e
+	case ">":
+		return a > e
+	case ">=":
+		return a >= e
+	case "==":
+		return a == e
+	case "!=":
+		return a != e
+	}
+	return false
+}
+
+var comparators = map[string]string{
+	"LT": "<",
+	"GT": ">",
+	"EQ": "==",
+	"NE": "!=",
 }
 
 type InResponse struct {
-	Version shared.Version `json:"version"`
+	Version  shared.Version         `json:"version"`
+	Metadata []shared.MetadataField `json:"metadata,omitempty"`
 }
 
 func main() {
 	downloadDir := os.Args[1]
-	if err := run(os.Stdin, os.Stdout, downloadDir);
+	if err := run(os.Stdin, os.Stdout, os.Stderr, downloadDir);
 		err != nil {
 		log.Fatalln(err)
 		os.Exit(1)
 	}
 }
 
-func run(stdIn io.Reader, stdOut io.Writer, downloadDir string) error {
+func run(stdIn io.Reader, stdOut io.Writer, stdErr io.Writer, downloadDir string) error {
 	var input InRequest
 	if err := json.NewDecoder(stdIn).Decode(&input); err != nil {
 		return err
@@ -42,52 +108,174 @@ func run(stdIn io.Reader, stdOut io.Writer, downloadDir string) error {
 		return errors.New("mandatory field is missing")
 	}
 
-	result, err := getResult(
-		input.Source.Target,
-		input.Source.SonarToken,
+	if input.Source.Mode == shared.BranchesMode {
+		destinationPath := filepath.Join(downloadDir, "branches.json")
+		if err := ioutil.WriteFile(destinationPath, []byte(input.Version["branches"]), os.ModePerm); err != nil {
+			return err
+		}
+		return json.NewEncoder(stdOut).Encode(InResponse{Version: input.Version})
+	}
+
+	var thresholds []Threshold
+	for _, rule := range input.Params.Thresholds {
+		threshold, err := parseThreshold(rule)
+		if err != nil {
+			return err
+		}
+		thresholds = append(thresholds, threshold)
+	}
+
+	pullRequest := input.Source.PullRequest
+	if input.Params.PullRequest != "" {
+		pullRequest = input.Params.PullRequest
+	}
+
+	client, err := shared.NewClient(input.Source)
+	if err != nil {
+		return err
+	}
+
+	result, err := client.MeasuresOf(
 		input.Source.Component,
+		input.Source.Branch,
+		pullRequest,
 		input.Source.Metrics,
+		input.Version,
 	)
 	if err != nil {
 		return err
 	}
 
 	destinationPath := filepath.Join(downloadDir, "result.json")
-	ioutil.WriteFile(destinationPath, result, os.ModePerm)
+	if err := ioutil.WriteFile(destinationPath, result, os.ModePerm); err != nil {
+		return err
+	}
+
+	if len(thresholds) > 0 {
+		if err := checkThresholds(result, thresholds, stdErr); err != nil {
+			return err
+		}
+	}
+
+	qualityGate, err := client.QualityGate(
+		input.Source.Component,
+		input.Source.Branch,
+		pullRequest,
+		input.Version.Analysis(),
+	)
+	if err != nil {
+		return err
+	}
+
+	qualityGatePath := filepath.Join(downloadDir, "quality_gate.json")
+	if err := ioutil.WriteFile(qualityGatePath, qualityGate, os.ModePerm); err != nil {
+		return err
+	}
+
+	if input.Params.Issues != nil {
+		issues, err := getAllIssues(
+			client,
+			issuesQuery(input.Source.Component, input.Source.Branch, pullRequest, *input.Params.Issues),
+		)
+		if err != nil {
+			return err
+		}
+		issuesPath := filepath.Join(downloadDir, "issues.json")
+		if err := ioutil.WriteFile(issuesPath, issues, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	if input.Params.Hotspots != nil {
+		hotspots, err := getAllHotspots(
+			client,
+			hotspotsQuery(input.Source.Component, input.Source.Branch, pullRequest, *input.Params.Hotspots),
+		)
+		if err != nil {
+			return err
+		}
+		hotspotsPath := filepath.Join(downloadDir, "hotspots.json")
+		if err := ioutil.WriteFile(hotspotsPath, hotspots, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	if input.Params.FailOnQualityGate {
+		if err := checkQualityGate(qualityGate, input.Params.FailOnWarning); err != nil {
+			return err
+		}
+	}
 
 	return json.
 		NewEncoder(stdOut).
 		Encode(InResponse{
-			Version: input.Version,
+			Version:  input.Version,
+			Metadata: input.Version.Metadata(),
 		})
 }
 
-func getResult(baseUrl string, authToken string, component string, metrics string) ([]byte, error) {
-	fullUrl, err := url.Parse(baseUrl)
-	if err != nil {
-		return nil, err
+// checkThresholds prints a pass/fail table of all thresholds
+// and fails when any of them isn't met.
+func checkThresholds(result []byte, thresholds []Threshold, stdErr io.Writer) error {
+	var response shared.MeasuresResponse
+	if err := json.Unmarshal(result, &response); err != nil {
+		return err
+	}
+	measures := map[string]shared.Measure{}
+	for _, m := range response.Component.Measures {
+		measures[m.Metric] = m
 	}
-	fullUrl.Path += "/api/measures/component"
-	parameters := url.Values{}
-	parameters.Add("component", component)
-	parameters.Add("metricKeys", metrics)
-	fullUrl.RawQuery = parameters.Encode()
 
-	req, err := http.NewRequest("GET", fullUrl.String(), nil)
-	req.SetBasicAuth(authToken, "")
+	var failed int
+	table := tabwriter.NewWriter(stdErr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "METRIC\tTHRESHOLD\tACTUAL\tRESULT")
+	for _, t := range thresholds {
+		actual, ok := measures[t.Metric].ActualValue()
+		result := "PASS"
+		if !ok {
+			actual = "-"
+			result = "FAIL"
+		} else if !t.passes(actual) {
+			result = "FAIL"
+		}
+		if result == "FAIL" {
+			failed++
+		}
+		fmt.Fprintf(table, "%v\t%v %v\t%v\t%v\n", t.Metric, t.Operator, t.Value, actual, result)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(thresholds)) + " thresholds failed")
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+// checkQualityGate fails with a summary of the failing conditions,
+// when the quality gate is ERROR or optionally WARN.
+func checkQualityGate(qualityGate []byte, failOnWarning bool) error {
+	var response shared.QualityGateResponse
+	if err := json.Unmarshal(qualityGate, &response); err != nil {
+		return err
 	}
-	if resp.StatusCode != 200 {
-		return nil, errors.New("Status " + strconv.Itoa(resp.StatusCode) + " : " + string(body))
+
+	status := response.ProjectStatus.Status
+	if status != "ERROR" && !(failOnWarning && status == "WARN") {
+		return nil
+	}
+
+	summary := []string{"quality gate failed with status " + status}
+	for _, c := range response.ProjectStatus.Conditions {
+		if c.Status == "OK" {
+			continue
+		}
+		threshold := c.ErrorThreshold
+		if c.Status == "WARN" {
+			threshold = c.WarningThreshold
+		}
+		summary = append(summary, "  "+c.Status+" "+c.MetricKey+": "+c.ActualValue+" "+comparators[c.Comparator]+" "+threshold)
 	}
-	return body, nil
+	return errors.New(strings.Join(summary, "\n"))
 }
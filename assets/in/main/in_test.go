@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared/sharedtest"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -62,21 +64,77 @@ const (
 		    ]
 		  }
 		}`
-	suffix = "/api/measures/component?component=my%3Acomponent&metricKeys=ncloc%2Ccomplexity%2Cviolations%2Ccoverage"
+	mockQualityGateResponse = `{
+		  "projectStatus": {
+		    "status": "ERROR",
+		    "conditions": [
+		      {
+		        "status": "ERROR",
+		        "metricKey": "new_coverage",
+		        "comparator": "LT",
+		        "errorThreshold": "85",
+		        "actualValue": "82.5"
+		      },
+		      {
+		        "status": "OK",
+		        "metricKey": "new_bugs",
+		        "comparator": "GT",
+		        "errorThreshold": "0",
+		        "actualValue": "0"
+		      }
+		    ]
+		  }
+		}`
+	mockHistoryResponse = `{
+		  "paging": {
+		    "pageIndex": 1,
+		    "pageSize": 100,
+		    "total": 1
+		  },
+		  "measures": [
+		    {
+		      "metric": "coverage",
+		      "history": [
+		        {
+		          "date": "2018-04-06T14:27:06+0200",
+		          "value": "88.1"
+		        }
+		      ]
+		    },
+		    {
+		      "metric": "violations",
+		      "history": [
+		        {
+		          "date": "2018-04-06T12:27:06+0000",
+		          "value": "7"
+		        }
+		      ]
+		    },
+		    {
+		      "metric": "ncloc",
+		      "history": []
+		    }
+		  ]
+		}`
+	measuresPath    = "/api/measures/component"
+	historyPath     = "/api/measures/search_history"
+	analysesPath    = "/api/project_analyses/search"
+	qualityGatePath = "/api/qualitygates/project_status"
+	suffix          = "/api/measures/component?component=my%3Acomponent&metricKeys=ncloc%2Ccomplexity%2Cviolations%2Ccoverage"
 )
 
-func setup(t *testing.T) (stdIn *bytes.Buffer, stdOut *bytes.Buffer, tmpDir string) {
+func setup(t *testing.T) (stdIn *bytes.Buffer, stdOut *bytes.Buffer, stdErr *bytes.Buffer, tmpDir string) {
 	var err error
 	tmpDir, err = ioutil.TempDir("", "concourse-sonarqube")
 	if err != nil {
 		t.Error(err)
 	}
-	return &bytes.Buffer{}, &bytes.Buffer{}, tmpDir
+	return &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, tmpDir
 	
 }
 
 func TestWritesContentIntoDownloadDirectory(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	var called bool
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -99,7 +157,7 @@ func TestWritesContentIntoDownloadDirectory(t *testing.T) {
 			}
 		}`, s.URL))
 
-	if err := run(stdIn, stdOut, tmpDir); err != nil {
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
 		t.Error(err)
 	}
 
@@ -107,30 +165,486 @@ func TestWritesContentIntoDownloadDirectory(t *testing.T) {
 		t.Error("Didn't call the remote service")
 	}
 
-	expectedDestination, err := ioutil.ReadDir(tmpDir)
+	fullPath := filepath.Join(tmpDir, "result.json")
+	if _, err := os.Stat(fullPath); err != nil {
+		t.Errorf("Expected a file named result.json to be created, but was not: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(fullPath)
 	if err != nil {
 		t.Error(err)
 	}
-	if len(expectedDestination) < 1 {
-		t.Errorf("Expected a file to be created, but was not")
+	if string(content) != mockResponse {
+		t.Errorf("Expected content to be %v, but was %v", mockResponse, string(content))
+	}
+}
+
+func TestWritesMeasuresOfTheAnalysisOfTheVersion(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case analysesPath:
+			if _, err := w.Write([]byte(`{"analyses":[{"key":"AWKzvBzTdrIzrRaH-VOH","date":"2018-04-08T09:12:43+0200"}]}`)); err != nil {
+				t.Error(err)
+			}
+		case historyPath:
+			called = true
+			expected := historyPath + "?branch=release%2F1.0&component=my%3Acomponent&from=2018-04-06T14%3A27%3A06%2B0200&metrics=ncloc%2Ccomplexity%2Cviolations%2Ccoverage&to=2018-04-06T14%3A27%3A06%2B0200"
+			if r.URL.String() != expected {
+				t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+			}
+			if _, err := w.Write([]byte(mockHistoryResponse)); err != nil {
+				t.Error(err)
+			}
+		case measuresPath:
+			t.Error("Expected the current measures not to be requested")
+		default:
+			if _, err := w.Write([]byte(mockQualityGateResponse)); err != nil {
+				t.Error(err)
+			}
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"branch": "release/1.0"
+  			},
+  			"version": {
+				"analysis": "AWKa7VV9drIzrRaH-p_z",
+				"date": "2018-04-06T14:27:06+0200"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
 	}
-	name := expectedDestination[0].Name()
-	if name != "result.json" {
-		t.Errorf("Expected the file to be named correctly, but was %v", name)
+
+	if !called {
+		t.Error("Didn't call the history")
 	}
 
-	fullPath := filepath.Join(tmpDir, "result.json")
-	content, err := ioutil.ReadFile(fullPath)
+	content, err := ioutil.ReadFile(filepath.Join(tmpDir, "result.json"))
 	if err != nil {
 		t.Error(err)
 	}
-	if string(content) != mockResponse {
-		t.Errorf("Expected content to be %v, but was %v", mockResponse, string(content))
+	expected := `{"component":{"key":"my:component","measures":[{"metric":"coverage","value":"88.1"},{"metric":"violations","value":"7"}]}}`
+	if string(content) != expected {
+		t.Errorf("Expected content to be %v, but was %v", expected, string(content))
+	}
+}
+
+func TestReturnsErrorIfAnalysisHasNoMeasures(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(`{"measures":[{"metric":"coverage","history":[]}]}`)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage"
+  			},
+  			"version": {
+				"analysis": "AWKa7VV9drIzrRaH-p_z",
+				"date": "2018-04-06T14:27:06+0200"
+			}
+		}`, s.URL))
+
+	err := run(stdIn, stdOut, stdErr, tmpDir)
+	if err == nil || err.Error() != "no measures found for analysis at 2018-04-06T14:27:06+0200" {
+		t.Errorf("Expected missing measures, but was %v", err)
+	}
+}
+
+func TestWritesQualityGateIntoDownloadDirectory(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := mockResponse
+		if r.URL.Path == qualityGatePath {
+			called = true
+			expected := qualityGatePath + "?analysisId=AWKa7VV9drIzrRaH-p_z"
+			if r.URL.String() != expected {
+				t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+			}
+			response = mockQualityGateResponse
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"branch": "release/1.0"
+  			},
+  			"version": {
+				"analysis": "AWKa7VV9drIzrRaH-p_z"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the quality gate")
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(tmpDir, "quality_gate.json"))
+	if err != nil {
+		t.Error(err)
+	}
+	if string(content) != mockQualityGateResponse {
+		t.Errorf("Expected content to be %v, but was %v", mockQualityGateResponse, string(content))
+	}
+}
+
+func TestRequestsQualityGateOfTheBranchWithoutAnalysis(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := mockResponse
+		if r.URL.Path == qualityGatePath {
+			called = true
+			expected := qualityGatePath + "?branch=release%2F1.0&projectKey=my%3Acomponent"
+			if r.URL.String() != expected {
+				t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+			}
+			response = mockQualityGateResponse
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"branch": "release/1.0"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the quality gate")
+	}
+}
+
+func TestReturnsErrorIfQualityGateCouldNotBeFetched(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == qualityGatePath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err == nil {
+		t.Error("Expected error, but didn't error")
+	}
+}
+
+func TestFailsWhenQualityGateIsNotOk(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := mockResponse
+		if r.URL.Path == qualityGatePath {
+			response = mockQualityGateResponse
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"fail_on_quality_gate": true
+			}
+		}`, s.URL))
+
+	err := run(stdIn, stdOut, stdErr, tmpDir)
+	expected := "quality gate failed with status ERROR\n  ERROR new_coverage: 82.5 < 85"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %v, but was %v", expected, err)
+	}
+}
+
+func TestFailsOnWarningWhenConfigured(t *testing.T) {
+	for _, failOnWarning := range []bool{true, false} {
+		stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response := mockResponse
+			if r.URL.Path == qualityGatePath {
+				response = `{"projectStatus":{"status":"WARN","conditions":[
+					{"status":"WARN","metricKey":"new_bugs","comparator":"GT","warningThreshold":"0","actualValue":"2"}]}}`
+			}
+			if _, err := w.Write([]byte(response)); err != nil {
+				t.Error(err)
+			}
+		}))
+
+		stdIn.WriteString(fmt.Sprintf(`{
+				"source": {
+    				"target": "%v",
+					"sonartoken": "token",
+    				"component": "my:component",
+    				"metrics": "ncloc,complexity,violations,coverage"
+  				},
+  				"version": {
+					"ref": "61cebf"
+				},
+  				"params": {
+					"fail_on_quality_gate": true,
+					"fail_on_warning": %v
+				}
+			}`, s.URL, failOnWarning))
+
+		err := run(stdIn, stdOut, stdErr, tmpDir)
+		s.Close()
+		if failOnWarning {
+			expected := "quality gate failed with status WARN\n  WARN new_bugs: 2 > 0"
+			if err == nil || err.Error() != expected {
+				t.Errorf("Expected error %v, but was %v", expected, err)
+			}
+		} else if err != nil {
+			t.Errorf("Expected warning to pass, but was %v", err)
+		}
+	}
+}
+
+func TestDoesNotFailOnQualityGateByDefault(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := mockResponse
+		if r.URL.Path == qualityGatePath {
+			response = mockQualityGateResponse
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFailsWhenThresholdsAreNotMet(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"thresholds": ["coverage >= 80", "violations == 0", "new_bugs == 0"]
+			}
+		}`, s.URL))
+
+	err := run(stdIn, stdOut, stdErr, tmpDir)
+	if err == nil || err.Error() != "2 of 3 thresholds failed" {
+		t.Errorf("Expected thresholds to fail, but was %v", err)
+	}
+
+	expectedTable := "METRIC      THRESHOLD  ACTUAL  RESULT\n" +
+		"coverage    >= 80      91.2    PASS\n" +
+		"violations  == 0       5       FAIL\n" +
+		"new_bugs    == 0       -       FAIL\n"
+	if stdErr.String() != expectedTable {
+		t.Errorf("Expected table to be\n%v, but was\n%v", expectedTable, stdErr.String())
+	}
+}
+
+func TestPassesWhenThresholdsAreMet(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := `{"component":{"measures":[
+			{"metric":"coverage","value":"91.2"},
+			{"metric":"new_bugs","period":{"index":1,"value":"0"}},
+			{"metric":"alert_status","value":"OK"}]}}`
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,new_bugs,alert_status"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"thresholds": ["coverage>80", "new_bugs == 0", "alert_status != ERROR"]
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChecksThresholdsOfNewCodeOnTheLatestAnalysis(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch r.URL.Path {
+		case analysesPath:
+			response = `{"paging":{"pageIndex":1,"pageSize":1,"total":2},"analyses":[
+				{"key":"AWKa7VV9drIzrRaH-p_z","date":"2018-04-06T14:27:06+0200"}]}`
+		case measuresPath:
+			response = `{"component":{"measures":[{"metric":"new_bugs","period":{"index":1,"value":"0"}}]}}`
+		case historyPath:
+			t.Error("Expected the history not to be requested for the latest analysis")
+		default:
+			response = mockQualityGateResponse
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "new_bugs"
+  			},
+  			"version": {
+				"analysis": "AWKa7VV9drIzrRaH-p_z",
+				"date": "2018-04-06T14:27:06+0200"
+			},
+  			"params": {
+				"thresholds": ["new_bugs == 0"]
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestErrorsOnInvalidThreshold(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	stdIn.WriteString(`{
+			"source": {
+    			"target": "https://my.sonar.server",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"thresholds": ["coverage => 80"]
+			}
+		}`)
+
+	err := run(stdIn, stdOut, stdErr, tmpDir)
+	if err == nil || err.Error() != "invalid threshold coverage => 80" {
+		t.Errorf("Expected invalid threshold, but was %v", err)
 	}
 }
 
 func TestWritesVersionTostdOut(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	var called bool
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -153,7 +667,7 @@ func TestWritesVersionTostdOut(t *testing.T) {
 			}
 		}`, s.URL))
 
-	err := run(stdIn, stdOut, tmpDir)
+	err := run(stdIn, stdOut, stdErr, tmpDir)
 	if err != nil {
 		t.Error(err)
 	}
@@ -172,13 +686,80 @@ func TestWritesVersionTostdOut(t *testing.T) {
 	}
 }
 
+func TestWritesAnalysisMetadataTostdOut(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := mockResponse
+		if r.URL.Path == historyPath {
+			response = mockHistoryResponse
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"analysis": "AWKa7VV9drIzrRaH-p_z",
+				"date": "2018-04-06T14:27:06+0200",
+				"revision": "61cebf"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	expectedResponse := `{"version":{"analysis":"AWKa7VV9drIzrRaH-p_z","date":"2018-04-06T14:27:06+0200","revision":"61cebf"},"metadata":[{"name":"analysis","value":"AWKa7VV9drIzrRaH-p_z"},{"name":"date","value":"2018-04-06T14:27:06+0200"},{"name":"revision","value":"61cebf"}]}` + "\n"
+	if stdOut.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdOut.String())
+	}
+}
+
+func TestWritesBranchesInBranchesMode(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	stdIn.WriteString(`{
+			"source": {
+    			"target": "https://my.sonar.server",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"mode": "branches"
+  			},
+  			"version": {
+				"branches": "[{\"name\":\"main\"}]"
+			}
+		}`)
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(tmpDir, "branches.json"))
+	if err != nil {
+		t.Error(err)
+	}
+	if string(content) != `[{"name":"main"}]` {
+		t.Errorf("Expected branches to be written, but was %v", string(content))
+	}
+}
+
 func TestRequestsTheCorrectUrl(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	var called bool
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		called = true
-		if r.URL.String() != suffix {
+		if r.URL.Path == measuresPath && r.URL.String() != suffix {
 			t.Errorf("Expected %v, but got %v", suffix, r.URL.String())
 		}
 		if _, err := w.Write([]byte(mockResponse)); err != nil {
@@ -199,7 +780,7 @@ func TestRequestsTheCorrectUrl(t *testing.T) {
 			}
 		}`, s.URL))
 
-	err := run(stdIn, stdOut, tmpDir)
+	err := run(stdIn, stdOut, stdErr, tmpDir)
 	if err != nil {
 		t.Error(err)
 	}
@@ -209,8 +790,168 @@ func TestRequestsTheCorrectUrl(t *testing.T) {
 	}
 }
 
+func TestRequestsMeasuresOfTheBranch(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		expected := "/api/measures/component?branch=release%2F1.0&component=my%3Acomponent&metricKeys=ncloc%2Ccomplexity%2Cviolations%2Ccoverage"
+		if r.URL.Path == measuresPath && r.URL.String() != expected {
+			t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"branch": "release/1.0"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+}
+
+func TestRequestsMeasuresOfThePullRequest(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		expected := "/api/measures/component?component=my%3Acomponent&metricKeys=ncloc%2Ccomplexity%2Cviolations%2Ccoverage&pullRequest=42"
+		if r.URL.Path == measuresPath && r.URL.String() != expected {
+			t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"pull_request": "42"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+}
+
+func TestPullRequestParamOverridesSource(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if pr := r.URL.Query().Get("pullRequest"); r.URL.Path == measuresPath && pr != "43" {
+			t.Errorf("Expected pull request 43, but got %v", pr)
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"pull_request": "42"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"pull_request": "43"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+}
+
+func TestPullRequestParamReplacesBranchOfSource(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	var paths []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		query := r.URL.Query()
+		if query.Get("branch") != "" || query.Get("pullRequest") != "43" {
+			t.Errorf("Expected only pull request 43, but got %v", r.URL.String())
+		}
+		response := mockResponse
+		if r.URL.Path == qualityGatePath {
+			response = mockQualityGateResponse
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"branch": "release/1.0"
+  			},
+  			"params": {
+				"pull_request": "43",
+				"issues": {},
+				"hotspots": {}
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	if len(paths) != 4 {
+		t.Errorf("Expected measures, quality gate, issues and hotspots to be requested, but got %v", paths)
+	}
+}
+
 func TestAddsAuthenticationToTheRequest(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	authToken := "token"
 
@@ -240,7 +981,7 @@ func TestAddsAuthenticationToTheRequest(t *testing.T) {
 			}
 		}`, s.URL, authToken))
 
-	err := run(stdIn, stdOut, tmpDir)
+	err := run(stdIn, stdOut, stdErr, tmpDir)
 	if err != nil {
 		t.Error(err)
 	}
@@ -250,8 +991,41 @@ func TestAddsAuthenticationToTheRequest(t *testing.T) {
 	}
 }
 
+func TestTrustsCACertificateOfTheServer(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	input := `{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"%v
+  			},
+  			"version": {
+				"ref": "61cebf"
+			}
+		}`
+
+	stdIn.WriteString(fmt.Sprintf(input, s.URL, ""))
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err == nil {
+		t.Error("Expected error for unknown certificate authority, but didn't")
+	}
+
+	stdIn.WriteString(fmt.Sprintf(input, s.URL, fmt.Sprintf(`, "ca_cert": %q`, sharedtest.CertificatePEM(s.Certificate()))))
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestReturnsErrorIfContentCouldNotBeFetched(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
@@ -270,13 +1044,13 @@ func TestReturnsErrorIfContentCouldNotBeFetched(t *testing.T) {
 			}
 		}`, s.URL))
 
-	if err := run(stdIn, stdOut, tmpDir); err == nil {
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err == nil {
 		t.Error("Expected error, but didn't error")
 	}
 }
 
 func TestReturnsErrorIfUnauthorized(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -295,13 +1069,13 @@ func TestReturnsErrorIfUnauthorized(t *testing.T) {
 			}
 		}`, s.URL))
 
-	if err := run(stdIn, stdOut, tmpDir); err == nil {
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err == nil {
 		t.Error("Expected error, but didn't error")
 	}
 }
 
 func TestErrorsWhenTargetIsMissing(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	stdIn.WriteString(`{
 				"source": {
@@ -315,14 +1089,14 @@ func TestErrorsWhenTargetIsMissing(t *testing.T) {
 				}
 			}`)
 
-	err := run(stdIn, stdOut, tmpDir)
+	err := run(stdIn, stdOut, stdErr, tmpDir)
 	if err.Error() != "mandatory field is missing" {
 		t.Errorf("Expected error to occure, but was %v", err)
 	}
 }
 
 func TestErrorsWhenComponentIsMissing(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	stdIn.WriteString(`{
 				"source": {
@@ -336,14 +1110,14 @@ func TestErrorsWhenComponentIsMissing(t *testing.T) {
 				}
 			}`)
 
-	err := run(stdIn, stdOut, tmpDir)
+	err := run(stdIn, stdOut, stdErr, tmpDir)
 	if err.Error() != "mandatory field is missing" {
 		t.Errorf("Expected error to occure, but was %v", err)
 	}
 }
 
 func TestErrorsWhenMetricsAreMissing(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	stdIn.WriteString(`{
 				"source": {
@@ -357,14 +1131,14 @@ func TestErrorsWhenMetricsAreMissing(t *testing.T) {
 				}
 			}`)
 
-	err := run(stdIn, stdOut, tmpDir)
+	err := run(stdIn, stdOut, stdErr, tmpDir)
 	if err.Error() != "mandatory field is missing" {
 		t.Errorf("Expected error to occure, but was %v", err)
 	}
 }
 
 func TestErrorsWhenSonartokenIsMissing(t *testing.T) {
-	stdIn, stdOut, tmpDir := setup(t)
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
 
 	stdIn.WriteString(`{
 				"source": {
@@ -378,7 +1152,7 @@ func TestErrorsWhenSonartokenIsMissing(t *testing.T) {
 				}
 			}`)
 
-	err := run(stdIn, stdOut, tmpDir)
+	err := run(stdIn, stdOut, stdErr, tmpDir)
 	if err.Error() != "mandatory field is missing" {
 		t.Errorf("Expected error to occure, but was %v", err)
 	}
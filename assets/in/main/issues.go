@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// SonarQube refuses to return more than 10000 results for one search.
+	issuesSearchLimit = 10000
+	issuesPageSize    = 500
+	issuesDateLayout  = "2006-01-02T15:04:05-0700"
+)
+
+type IssuesParams struct {
+	Severities  string `json:"severities"`
+	Types       string `json:"types"`
+	Statuses    string `json:"statuses"`
+	NewCodeOnly bool   `json:"new_code_only"`
+}
+
+type Issues struct {
+	Total  int               `json:"total"`
+	Issues []json.RawMessage `json:"issues"`
+}
+
+func issuesQuery(component string, branch string, pullRequest string, params IssuesParams) url.Values {
+	query := url.Values{}
+	query.Add("components", component)
+	shared.AddBranchOrPullRequest(query, branch, pullRequest)
+	if params.Severities != "" {
+		query.Add("severities", params.Severities)
+	}
+	if params.Types != "" {
+		query.Add("types", params.Types)
+	}
+	if params.Statuses != "" {
+		query.Add("statuses", params.Statuses)
+	}
+	if params.NewCodeOnly {
+		query.Add("inNewCodePeriod", "true")
+	}
+	return query
+}
+
+// getAllIssues pages through all issues matching the query. When there are more
+// issues than a single search can return, the query is split by creation date.
+func getAllIssues(client *shared.Client, query url.Values) ([]byte, error) {
+	first, err := client.SearchRawIssues(query, 1, issuesPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := first.Issues
+	if first.Paging.Total > issuesSearchLimit {
+		from, err := creationDate(client, query, "true")
+		if err != nil {
+			return nil, err
+		}
+		to, err := creationDate(client, query, "false")
+		if err != nil {
+			return nil, err
+		}
+		issues, err = getIssuesCreatedBetween(client, query, from, to.Add(time.Second))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for page := 2; (page-1)*issuesPageSize < first.Paging.Total; page++ {
+			response, err := client.SearchRawIssues(query, page, issuesPageSize)
+			if err != nil {
+				return nil, err
+			}
+			issues = append(issues, response.Issues...)
+		}
+	}
+
+	if issues == nil {
+		issues = []json.RawMessage{}
+	}
+	return json.Marshal(Issues{Total: len(issues), Issues: issues})
+}
+
+// getIssuesCreatedBetween halves the date range until each part fits into a single search.
+func getIssuesCreatedBetween(client *shared.Client, query url.Values, from time.Time, to time.Time) ([]json.RawMessage, error) {
+	ranged := url.Values{}
+	for k, v := range query {
+		ranged[k] = v
+	}
+	ranged.Set("createdAfter", from.Format(issuesDateLayout))
+	ranged.Set("createdBefore", to.Format(issuesDateLayout))
+
+	first, err := client.SearchRawIssues(ranged, 1, issuesPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if first.Paging.Total > issuesSearchLimit {
+		if to.Sub(from) <= time.Second {
+			return nil, errors.New("more than " + strconv.Itoa(issuesSearchLimit) +
+				" issues were created at " + from.Format(issuesDateLayout))
+		}
+		middle := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+		if !middle.After(from) {
+			middle = from.Add(time.Second)
+		}
+		older, err := getIssuesCreatedBetween(client, query, from, middle)
+		if err != nil {
+			return nil, err
+		}
+		newer, err := getIssuesCreatedBetween(client, query, middle, to)
+		if err != nil {
+			return nil, err
+		}
+		return append(older, newer...), nil
+	}
+
+	issues := first.Issues
+	for page := 2; (page-1)*issuesPageSize < first.Paging.Total; page++ {
+		response, err := client.SearchRawIssues(ranged, page, issuesPageSize)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, response.Issues...)
+	}
+	return issues, nil
+}
+
+// creationDate returns the creation date of the oldest (asc) or newest issue.
+func creationDate(client *shared.Client, query url.Values, asc string) (time.Time, error) {
+	sorted := url.Values{}
+	for k, v := range query {
+		sorted[k] = v
+	}
+	sorted.Set("s", "CREATION_DATE")
+	sorted.Set("asc", asc)
+
+	response, err := client.SearchRawIssues(sorted, 1, 1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(response.Issues) == 0 {
+		return time.Time{}, errors.New("no issues found")
+	}
+
+	var issue shared.Issue
+	if err := json.Unmarshal(response.Issues[0], &issue); err != nil {
+		return time.Time{}, err
+	}
+	date, err := time.Parse(issuesDateLayout, issue.CreationDate)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return date.Truncate(time.Second), nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const issuesPath = "/api/issues/search"
+
+func issuesPage(t *testing.T, w http.ResponseWriter, r *http.Request, total int, key string) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("p"))
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("ps"))
+	var issues []string
+	for i := (page - 1) * pageSize; i < total && i < page*pageSize; i++ {
+		issues = append(issues, fmt.Sprintf(`{"key":"%v-%v","creationDate":"%v"}`, key, i, key))
+	}
+	response := fmt.Sprintf(`{"paging":{"pageIndex":%v,"pageSize":%v,"total":%v},"issues":[%v]}`,
+		page, pageSize, total, strings.Join(issues, ","))
+	if _, err := w.Write([]byte(response)); err != nil {
+		t.Error(err)
+	}
+}
+
+func readIssues(t *testing.T, tmpDir string) Issues {
+	content, err := ioutil.ReadFile(filepath.Join(tmpDir, "issues.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issues Issues
+	if err := json.Unmarshal(content, &issues); err != nil {
+		t.Fatal(err)
+	}
+	return issues
+}
+
+func TestWritesAllPagesOfIssues(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	var pages []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != issuesPath {
+			if _, err := w.Write([]byte(mockResponse)); err != nil {
+				t.Error(err)
+			}
+			return
+		}
+		query := r.URL.Query()
+		pages = append(pages, query.Get("p"))
+		expected := map[string]string{
+			"components":      "my:component",
+			"pullRequest":     "42",
+			"severities":      "BLOCKER,CRITICAL",
+			"types":           "BUG",
+			"statuses":        "OPEN",
+			"inNewCodePeriod": "true",
+			"ps":              "500",
+		}
+		for k, v := range expected {
+			if query.Get(k) != v {
+				t.Errorf("Expected %v to be %v, but got %v", k, v, query.Get(k))
+			}
+		}
+		issuesPage(t, w, r, 1200, "2018-04-06T14:27:06+0200")
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"pull_request": "42"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"issues": {
+					"severities": "BLOCKER,CRITICAL",
+					"types": "BUG",
+					"statuses": "OPEN",
+					"new_code_only": true
+				}
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(pages) != "[1 2 3]" {
+		t.Errorf("Expected pages [1 2 3] to be requested, but got %v", pages)
+	}
+	issues := readIssues(t, tmpDir)
+	if issues.Total != 1200 || len(issues.Issues) != 1200 {
+		t.Errorf("Expected 1200 issues, but got %v of %v", len(issues.Issues), issues.Total)
+	}
+}
+
+func TestSplitsIssuesByCreationDateAboveTheSearchLimit(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	older := time.Date(2018, 3, 8, 14, 31, 37, 0, time.FixedZone("", 3600))
+	newer := time.Date(2018, 4, 6, 14, 27, 6, 0, time.FixedZone("", 7200))
+	created := map[time.Time]int{older: 6000, newer: 5000}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != issuesPath {
+			if _, err := w.Write([]byte(mockResponse)); err != nil {
+				t.Error(err)
+			}
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("s") == "CREATION_DATE" {
+			date := newer
+			if query.Get("asc") == "true" {
+				date = older
+			}
+			issuesPage(t, w, r, 1, date.Format(issuesDateLayout))
+			return
+		}
+		if query.Get("createdAfter") == "" {
+			issuesPage(t, w, r, 11000, "unsplit")
+			return
+		}
+		after, err := time.Parse(issuesDateLayout, query.Get("createdAfter"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, err := time.Parse(issuesDateLayout, query.Get("createdBefore"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var total int
+		var key string
+		for date, count := range created {
+			if !date.Before(after) && date.Before(before) {
+				total += count
+				key = date.Format(issuesDateLayout)
+			}
+		}
+		issuesPage(t, w, r, total, key)
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"issues": {}
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	issues := readIssues(t, tmpDir)
+	if issues.Total != 11000 || len(issues.Issues) != 11000 {
+		t.Errorf("Expected 11000 issues, but got %v of %v", len(issues.Issues), issues.Total)
+	}
+	keys := map[string]bool{}
+	for _, raw := range issues.Issues {
+		var issue struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(raw, &issue); err != nil {
+			t.Fatal(err)
+		}
+		keys[issue.Key] = true
+	}
+	if len(keys) != 11000 {
+		t.Errorf("Expected 11000 distinct issues, but got %v", len(keys))
+	}
+}
+
+func TestDoesNotFetchIssuesByDefault(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == issuesPath {
+			t.Error("Expected issues not to be requested")
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err != nil {
+		t.Error(err)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(tmpDir, "issues.json")); err == nil {
+		t.Error("Expected issues.json not to be written")
+	}
+}
+
+func TestReturnsErrorIfIssuesCouldNotBeFetched(t *testing.T) {
+	stdIn, stdOut, stdErr, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == issuesPath {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := w.Write([]byte(mockResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"version": {
+				"ref": "61cebf"
+			},
+  			"params": {
+				"issues": {}
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, stdErr, tmpDir); err == nil {
+		t.Error("Expected error, but didn't error")
+	}
+}
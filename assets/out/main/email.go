@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const defaultSMTPPort = 587
+
+type EmailParams struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Subject  string   `json:"subject"`
+	StartTLS bool     `json:"starttls"`
+	CACert   string   `json:"ca_cert"`
+}
+
+var emailTemplate = template.Must(template.New("email").Funcs(template.FuncMap{
+	"format": formatMeasure,
+}).Parse(`<html>
+<body>
+<h2>Quality gate of {{.Component}} is {{.QualityGate.Status}}</h2>
+<table>
+{{range .Measures}}<tr><td>{{.Metric}}</td><td>{{format .}}</td></tr>
+{{end}}</table>
+<p><a href="{{.DashboardURL}}">Open in SonarQube</a></p>
+</body>
+</html>
+`))
+
+func notifyEmail(params EmailParams, report Report) error {
+	if params.Host == "" || params.From == "" || len(params.To) == 0 {
+		return errors.New("email host, from or to is missing")
+	}
+	port := params.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	subject := params.Subject
+	if subject == "" {
+		subject = "Quality gate of " + report.Component + " is " + report.QualityGate.Status
+	}
+
+	message, err := emailMessage(params, subject, report)
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.Dial(net.JoinHostPort(params.Host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		config := &tls.Config{ServerName: params.Host}
+		if params.CACert != "" {
+			if config.RootCAs, err = shared.CertPool(params.CACert); err != nil {
+				return err
+			}
+		}
+		if err := client.StartTLS(config); err != nil {
+			return err
+		}
+	} else if params.StartTLS {
+		return errors.New("smtp server doesn't support STARTTLS")
+	}
+	if params.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", params.Username, params.Password, params.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(params.From); err != nil {
+		return err
+	}
+	for _, to := range params.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(message); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// emailMessage renders the report as plain text and HTML alternatives.
+func emailMessage(params EmailParams, subject string, report Report) ([]byte, error) {
+	var text strings.Builder
+	text.WriteString("Quality gate of " + report.Component + " is " + report.QualityGate.Status + "\r\n\r\n")
+	for _, m := range report.Measures {
+		text.WriteString(m.Metric + ": " + formatMeasure(m) + "\r\n")
+	}
+	text.WriteString("\r\n" + report.DashboardURL + "\r\n")
+
+	var html bytes.Buffer
+	if err := emailTemplate.Execute(&html, report); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", text.String()},
+		{"text/html; charset=utf-8", html.String()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	message.WriteString("From: " + params.From + "\r\n")
+	message.WriteString("To: " + strings.Join(params.To, ", ") + "\r\n")
+	message.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: multipart/alternative; boundary=" + parts.Boundary() + "\r\n\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
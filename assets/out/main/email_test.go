@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared/sharedtest"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+type fakeSMTP struct {
+	listener   net.Listener
+	extensions []string
+	tlsConfig  *tls.Config
+	startedTLS bool
+	auth       string
+	from       string
+	to         []string
+	data       string
+	done       chan struct{}
+}
+
+// newFakeSMTP accepts a single session and records what was sent.
+func newFakeSMTP(t *testing.T, extensions ...string) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTP{listener: listener, extensions: extensions, done: make(chan struct{})}
+	go server.serve(t)
+	return server
+}
+
+// newFakeSMTPWithStartTLS advertises STARTTLS with the certificate of a TLS test server.
+func newFakeSMTPWithStartTLS(t *testing.T, certificates *httptest.Server) *fakeSMTP {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTP{
+		listener:   listener,
+		extensions: []string{"STARTTLS"},
+		tlsConfig:  certificates.TLS,
+		done:       make(chan struct{}),
+	}
+	go server.serve(t)
+	return server
+}
+
+func (s *fakeSMTP) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) Close() {
+	s.listener.Close()
+}
+
+func (s *fakeSMTP) serve(t *testing.T) {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { conn.Close() }()
+	text := textproto.NewConn(conn)
+	reply := func(line string) {
+		if err := text.PrintfLine("%s", line); err != nil {
+			t.Error(err)
+		}
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			reply("250-localhost")
+			for _, extension := range s.extensions {
+				reply("250-" + extension)
+			}
+			reply("250 AUTH PLAIN")
+		case "STARTTLS":
+			reply("220 Ready to start TLS")
+			conn = tls.Server(conn, s.tlsConfig)
+			text = textproto.NewConn(conn)
+			s.startedTLS = true
+			s.extensions = nil
+		case "AUTH":
+			s.auth = strings.TrimPrefix(line, "AUTH PLAIN ")
+			reply("235 Authentication successful")
+		case "MAIL":
+			s.from = line
+			reply("250 OK")
+		case "RCPT":
+			s.to = append(s.to, line)
+			reply("250 OK")
+		case "DATA":
+			reply("354 Go ahead")
+			data, err := text.ReadDotLines()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			s.data = strings.Join(data, "\n")
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Not implemented")
+		}
+	}
+}
+
+func TestSendsEmailNotification(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	smtp := newFakeSMTP(t)
+	defer smtp.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"email": {
+					"host": "127.0.0.1",
+					"port": %v,
+					"username": "ci",
+					"password": "secret",
+					"from": "ci@example.com",
+					"to": ["dev@example.com", "lead@example.com"]
+				}
+			}
+		}`, sonar.URL, smtp.port()))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	<-smtp.done
+
+	if auth, _ := base64.StdEncoding.DecodeString(smtp.auth); string(auth) != "\x00ci\x00secret" {
+		t.Errorf("Expected plain authentication, but got %q", auth)
+	}
+	if smtp.from != "MAIL FROM:<ci@example.com>" {
+		t.Errorf("Expected sender, but got %v", smtp.from)
+	}
+	if fmt.Sprint(smtp.to) != "[RCPT TO:<dev@example.com> RCPT TO:<lead@example.com>]" {
+		t.Errorf("Expected all recipients, but got %v", smtp.to)
+	}
+	for _, expected := range []string{
+		"Subject: Quality gate of my:component is ERROR",
+		"To: dev@example.com, lead@example.com",
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=utf-8",
+		"coverage: 91.2 (+40.5)",
+		"Content-Type: text/html; charset=utf-8",
+		"<tr><td>violations</td><td>5 (-6)</td></tr>",
+		`<a href="` + sonar.URL + `/dashboard?id=my%3Acomponent">`,
+	} {
+		if !strings.Contains(smtp.data, expected) {
+			t.Errorf("Expected mail to contain %v, but was %v", expected, smtp.data)
+		}
+	}
+}
+
+func TestReturnsErrorIfStartTLSIsRequiredButNotSupported(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	smtp := newFakeSMTP(t)
+	defer smtp.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"email": {
+					"host": "127.0.0.1",
+					"port": %v,
+					"from": "ci@example.com",
+					"to": ["dev@example.com"],
+					"starttls": true
+				}
+			}
+		}`, sonar.URL, smtp.port()))
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || err.Error() != "smtp server doesn't support STARTTLS" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
+
+func TestReturnsErrorIfRecipientsAreMissing(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"email": {
+					"host": "127.0.0.1",
+					"from": "ci@example.com"
+				}
+			}
+		}`, sonar.URL))
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || err.Error() != "email host, from or to is missing" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
+
+func TestSendsEmailOverStartTLS(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	certificates := httptest.NewTLSServer(http.NotFoundHandler())
+	certificates.Close()
+	smtp := newFakeSMTPWithStartTLS(t, certificates)
+	defer smtp.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"email": {
+					"host": "127.0.0.1",
+					"port": %v,
+					"username": "ci",
+					"password": "secret",
+					"from": "ci@example.com",
+					"to": ["dev@example.com"],
+					"subject": "Qualität von my:component",
+					"starttls": true,
+					"ca_cert": %q
+				}
+			}
+		}`, sonar.URL, smtp.port(), sharedtest.CertificatePEM(certificates.Certificate())))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	<-smtp.done
+
+	if !smtp.startedTLS {
+		t.Error("Expected STARTTLS to be used")
+	}
+	if auth, _ := base64.StdEncoding.DecodeString(smtp.auth); string(auth) != "\x00ci\x00secret" {
+		t.Errorf("Expected plain authentication, but got %q", auth)
+	}
+	if expected := "Subject: =?utf-8?q?Qualit=C3=A4t_von_my:component?="; !strings.Contains(smtp.data, expected) {
+		t.Errorf("Expected mail to contain %v, but was %v", expected, smtp.data)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// createEvent marks the given or the latest analysis with an event,
+// whose name is given directly or read from a file of the build.
+func createEvent(client *shared.Client, input OutRequest, pullRequest string, sourceDir string) (shared.Version, []shared.MetadataField, error) {
+	name := input.Params.EventName
+	if input.Params.EventFile != "" {
+		content, err := ioutil.ReadFile(filepath.Join(sourceDir, input.Params.EventFile))
+		if err != nil {
+			return nil, nil, err
+		}
+		name = strings.TrimSpace(string(content))
+	}
+	if name == "" {
+		return nil, nil, errors.New("event_name or event_file is missing")
+	}
+
+	var version shared.Version
+	var err error
+	if input.Params.Analysis != "" {
+		version, err = findAnalysis(client, input.Source.Component, input.Source.Branch, pullRequest, input.Params.Analysis)
+	} else {
+		version, err = lastAnalysis(client, input.Source.Component, input.Source.Branch, pullRequest)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response, err := client.CreateEvent(version.Analysis(), name, input.Params.EventCategory)
+	if err != nil {
+		return nil, nil, err
+	}
+	return version, []shared.MetadataField{
+		{Name: "event", Value: response.Event.Name},
+		{Name: "event_category", Value: response.Event.Category},
+	}, nil
+}
+
+func lastAnalysis(client *shared.Client, component string, branch string, pullRequest string) (shared.Version, error) {
+	result, err := client.SearchAnalyses(component, branch, pullRequest, "", 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	return latestVersion(result)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const createEventPath = "/api/project_analyses/create_event"
+
+func TestCreatesEventOnLatestAnalysisFromFile(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "version"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "version", "number"), []byte("1.2.3\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	var created bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch r.URL.Path {
+		case analysesPath:
+			if ps := r.URL.Query().Get("ps"); ps != "1" {
+				t.Errorf("Expected only the latest analysis to be requested, but got %v", ps)
+			}
+			response = mockAnalysesResponse
+		case createEventPath:
+			created = true
+			if r.Method != http.MethodPost {
+				t.Errorf("Expected POST, but got %v", r.Method)
+			}
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+			expected := map[string]string{"analysis": "AWKa7VV9drIzrRaH-p_z", "name": "1.2.3", "category": "VERSION"}
+			for k, v := range expected {
+				if r.PostForm.Get(k) != v {
+					t.Errorf("Expected %v to be %v, but got %v", k, v, r.PostForm.Get(k))
+				}
+			}
+			response = `{"event":{"key":"AU-TpxcA-iU5OvuD2FL5","analysis":"AWKa7VV9drIzrRaH-p_z","category":"VERSION","name":"1.2.3"}}`
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "create_event",
+				"event_file": "version/number",
+				"event_category": "VERSION"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if !created {
+		t.Error("Didn't create the event")
+	}
+	expectedResponse := `{"version":{"analysis":"AWKa7VV9drIzrRaH-p_z","date":"2018-04-06T14:27:06+0200","project_version":"0.0.1-SNAPSHOT","revision":"61cebf"},` +
+		`"metadata":[{"name":"analysis","value":"AWKa7VV9drIzrRaH-p_z"},{"name":"date","value":"2018-04-06T14:27:06+0200"},{"name":"project_version","value":"0.0.1-SNAPSHOT"},{"name":"revision","value":"61cebf"},` +
+		`{"name":"event","value":"1.2.3"},{"name":"event_category","value":"VERSION"}]}` + "\n"
+	if stdOut.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdOut.String())
+	}
+}
+
+func TestCreatesEventOnGivenAnalysis(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	var created bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch r.URL.Path {
+		case analysesPath:
+			response = `{"analyses":[
+				{"key":"AWKa7VV9drIzrRaH-p_z","date":"2018-04-06T14:27:06+0200"},
+				{"key":"AWKQ3B6rdrIzrRaH-Rt3","date":"2018-04-04T15:32:28+0200"}]}`
+		case createEventPath:
+			created = true
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+			if analysis := r.PostForm.Get("analysis"); analysis != "AWKQ3B6rdrIzrRaH-Rt3" {
+				t.Errorf("Expected the given analysis, but got %v", analysis)
+			}
+			if category := r.PostForm.Get("category"); category != "" {
+				t.Errorf("Expected no category, but got %v", category)
+			}
+			response = `{"event":{"key":"AU-TpxcA-iU5OvuD2FL5","analysis":"AWKQ3B6rdrIzrRaH-Rt3","category":"OTHER","name":"shipped"}}`
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "create_event",
+				"analysis": "AWKQ3B6rdrIzrRaH-Rt3",
+				"event_name": "shipped"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if !created {
+		t.Error("Didn't create the event")
+	}
+}
+
+func TestPagesThroughAnalysesToFindTheGivenOne(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	var created bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch r.URL.Path {
+		case analysesPath:
+			switch page := r.URL.Query().Get("p"); page {
+			case "1":
+				response = `{"paging":{"pageIndex":1,"pageSize":100,"total":101},"analyses":[
+					{"key":"AWKa7VV9drIzrRaH-p_z","date":"2018-04-06T14:27:06+0200"}]}`
+			case "2":
+				response = `{"paging":{"pageIndex":2,"pageSize":100,"total":101},"analyses":[
+					{"key":"AWKQ3B6rdrIzrRaH-Rt3","date":"2018-04-04T15:32:28+0200"}]}`
+			default:
+				t.Errorf("Unexpected page %v", page)
+			}
+		case createEventPath:
+			created = true
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+			if analysis := r.PostForm.Get("analysis"); analysis != "AWKQ3B6rdrIzrRaH-Rt3" {
+				t.Errorf("Expected the given analysis, but got %v", analysis)
+			}
+			response = `{"event":{"key":"AU-TpxcA-iU5OvuD2FL5","analysis":"AWKQ3B6rdrIzrRaH-Rt3","category":"OTHER","name":"shipped"}}`
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "create_event",
+				"analysis": "AWKQ3B6rdrIzrRaH-Rt3",
+				"event_name": "shipped"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if !created {
+		t.Error("Didn't create the event")
+	}
+}
+
+func TestReturnsErrorIfEventCouldNotBeCreated(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == createEventPath {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := w.Write([]byte(mockAnalysesResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "create_event",
+				"event_name": "1.2.3"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
+
+func TestReturnsErrorIfEventNameIsMissing(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	stdIn.WriteString(`{
+			"source": {
+    			"target": "https://my.sonar.server",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "create_event"
+			}
+		}`)
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || err.Error() != "event_name or event_file is missing" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
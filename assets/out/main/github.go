@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultGitHubURL   = "https://api.github.com"
+	githubCommentsPage = 100
+)
+
+type GitHubParams struct {
+	Token       string `json:"token"`
+	Repository  string `json:"repository"`
+	PullRequest string `json:"pull_request"`
+	BaseURL     string `json:"base_url"`
+	Marker      string `json:"marker"`
+}
+
+type GitHubComment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+// commentOnGitHub creates a comment on the pull request or updates the one carrying the marker,
+// so there is only a single comment per component.
+func commentOnGitHub(params GitHubParams, pullRequest string, report Report) error {
+	if params.PullRequest != "" {
+		pullRequest = params.PullRequest
+	}
+	if params.Token == "" || params.Repository == "" || pullRequest == "" {
+		return errors.New("github token, repository or pull_request is missing")
+	}
+	marker := params.Marker
+	if marker == "" {
+		marker = "<!-- sonarqube:" + report.Component + " -->"
+	}
+	body := marker + "\n" + markdown(report)
+
+	comments := "/repos/" + params.Repository + "/issues/" + pullRequest + "/comments"
+	for page := 1; ; page++ {
+		var existing []GitHubComment
+		path := comments + "?per_page=" + strconv.Itoa(githubCommentsPage) + "&page=" + strconv.Itoa(page)
+		if err := githubRequest(params, http.MethodGet, path, nil, &existing); err != nil {
+			return err
+		}
+		for _, c := range existing {
+			if strings.Contains(c.Body, marker) {
+				path := "/repos/" + params.Repository + "/issues/comments/" + strconv.FormatInt(c.ID, 10)
+				return githubRequest(params, http.MethodPatch, path, GitHubComment{Body: body}, nil)
+			}
+		}
+		if len(existing) < githubCommentsPage {
+			break
+		}
+	}
+	return githubRequest(params, http.MethodPost, comments, GitHubComment{Body: body}, nil)
+}
+
+func githubRequest(params GitHubParams, method string, path string, in interface{}, out interface{}) error {
+	baseURL := params.BaseURL
+	if baseURL == "" {
+		baseURL = defaultGitHubURL
+	}
+	headers := map[string]string{
+		"Accept":        "application/vnd.github+json",
+		"Authorization": "Bearer " + params.Token,
+	}
+	return sendJSON(method, strings.TrimSuffix(baseURL, "/")+path, headers, in, out)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// GitHub accepts at most 50 annotations per request to the Checks API.
+	annotationsPerRequest = 50
+	newIssuesPageSize     = 500
+	// Annotating more issues than a single search returns wouldn't help reviewing a change,
+	// so the remaining ones are only counted in the summary.
+	newIssuesLimit = 10000
+)
+
+type GitHubCheckParams struct {
+	Token      string `json:"token"`
+	Repository string `json:"repository"`
+	Sha        string `json:"sha"`
+	BaseURL    string `json:"base_url"`
+	Name       string `json:"name"`
+}
+
+type CheckRun struct {
+	ID         int64        `json:"id,omitempty"`
+	Name       string       `json:"name,omitempty"`
+	HeadSha    string       `json:"head_sha,omitempty"`
+	Status     string       `json:"status,omitempty"`
+	Conclusion string       `json:"conclusion,omitempty"`
+	DetailsURL string       `json:"details_url,omitempty"`
+	Output     *CheckOutput `json:"output,omitempty"`
+}
+
+type CheckOutput struct {
+	Title       string            `json:"title"`
+	Summary     string            `json:"summary"`
+	Annotations []CheckAnnotation `json:"annotations,omitempty"`
+}
+
+type CheckAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Message         string `json:"message"`
+	Title           string `json:"title,omitempty"`
+}
+
+// createGitHubCheck completes a check run on the analysed commit with the new issues as annotations.
+// As the Checks API limits the number of annotations per request, the remaining ones are added by updating the run.
+func createGitHubCheck(client *shared.Client, params GitHubCheckParams, input OutRequest, pullRequest string, report Report) error {
+	sha := params.Sha
+	if sha == "" {
+		sha = report.Version["revision"]
+	}
+	if params.Token == "" || params.Repository == "" || sha == "" {
+		return errors.New("github check token, repository or sha is missing")
+	}
+	name := params.Name
+	if name == "" {
+		name = "sonarqube"
+	}
+
+	issues, total, err := getNewIssues(
+		client,
+		input.Source.Component,
+		input.Source.Branch,
+		pullRequest,
+	)
+	if err != nil {
+		return err
+	}
+	annotations := checkAnnotations(issues, input.Source.Component)
+	summary := markdown(report)
+	if total > len(issues) {
+		summary += "\nOnly the first " + strconv.Itoa(len(issues)) + " of " + strconv.Itoa(total) + " new issues are annotated.\n"
+	}
+	output := func(batch []CheckAnnotation) *CheckOutput {
+		return &CheckOutput{
+			Title:       "Quality gate " + report.QualityGate.Status + ", " + strconv.Itoa(total) + " new issues",
+			Summary:     summary,
+			Annotations: batch,
+		}
+	}
+	batch := func(i int) []CheckAnnotation {
+		end := i + annotationsPerRequest
+		if end > len(annotations) {
+			end = len(annotations)
+		}
+		return annotations[i:end]
+	}
+
+	gitHub := GitHubParams{Token: params.Token, BaseURL: params.BaseURL}
+	checkRuns := "/repos/" + params.Repository + "/check-runs"
+	var created CheckRun
+	if err := githubRequest(gitHub, http.MethodPost, checkRuns, CheckRun{
+		Name:       name,
+		HeadSha:    sha,
+		Status:     "completed",
+		Conclusion: checkConclusion(report.QualityGate.Status),
+		DetailsURL: report.DashboardURL,
+		Output:     output(batch(0)),
+	}, &created); err != nil {
+		return err
+	}
+	for i := annotationsPerRequest; i < len(annotations); i += annotationsPerRequest {
+		path := checkRuns + "/" + strconv.FormatInt(created.ID, 10)
+		if err := githubRequest(gitHub, http.MethodPatch, path, CheckRun{Output: output(batch(i))}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkConclusion(status string) string {
+	switch status {
+	case "OK":
+		return "success"
+	case "ERROR":
+		return "failure"
+	}
+	return "neutral"
+}
+
+// checkAnnotations skips issues on the project itself, as annotations need a file.
+func checkAnnotations(issues []shared.Issue, component string) []CheckAnnotation {
+	var annotations []CheckAnnotation
+	for _, issue := range issues {
+		path := issue.Path(component)
+		if path == issue.Component {
+			continue
+		}
+		start, end := issue.Line, issue.Line
+		if issue.TextRange != nil {
+			start, end = issue.TextRange.StartLine, issue.TextRange.EndLine
+		}
+		if start == 0 {
+			start, end = 1, 1
+		}
+		annotations = append(annotations, CheckAnnotation{
+			Path:            path,
+			StartLine:       start,
+			EndLine:         end,
+			AnnotationLevel: annotationLevel(issue.Severity),
+			Message:         issue.Message,
+			Title:           issue.Severity + " " + issue.Type + " (" + issue.Rule + ")",
+		})
+	}
+	return annotations
+}
+
+func annotationLevel(severity string) string {
+	switch severity {
+	case "BLOCKER", "CRITICAL":
+		return "failure"
+	case "MAJOR":
+		return "warning"
+	}
+	return "notice"
+}
+
+// getNewIssues pages through the unresolved issues of the new code period up to newIssuesLimit
+// and returns them together with the total number. All issues of a pull request are new.
+func getNewIssues(client *shared.Client, component string, branch string, pullRequest string) ([]shared.Issue, int, error) {
+	query := url.Values{}
+	query.Add("components", component)
+	shared.AddBranchOrPullRequest(query, branch, pullRequest)
+	if pullRequest == "" {
+		query.Add("inNewCodePeriod", "true")
+	}
+	query.Add("resolved", "false")
+
+	var issues []shared.Issue
+	var total int
+	for page := 1; page*newIssuesPageSize <= newIssuesLimit; page++ {
+		response, err := client.SearchIssues(query, page, newIssuesPageSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		issues = append(issues, response.Issues...)
+		total = response.Paging.Total
+		if page*newIssuesPageSize >= total {
+			break
+		}
+	}
+	return issues, total, nil
+}
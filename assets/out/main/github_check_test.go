@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const issuesPath = "/api/issues/search"
+
+// newSonarServerWithIssues adds issues of main.go to the analysis, with the last one on the project itself.
+func newSonarServerWithIssues(t *testing.T, total int) *httptest.Server {
+	sonar := sonarHandler(t)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != issuesPath {
+			sonar(w, r)
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("pullRequest") != "42" || query.Get("resolved") != "false" {
+			t.Errorf("Expected unresolved issues of the pull request, but got %v", r.URL.String())
+		}
+		var issues []string
+		for i := 0; i < total-1; i++ {
+			issues = append(issues, fmt.Sprintf(`{"key":"%v","component":"my:component:src/main.go","line":%v,`+
+				`"textRange":{"startLine":%v,"endLine":%v},"message":"Fix it","severity":"MAJOR","type":"BUG","rule":"go:S1"}`, i, i+1, i+1, i+2))
+		}
+		issues = append(issues, `{"key":"project","component":"my:component","message":"Add tests","severity":"INFO","type":"CODE_SMELL"}`)
+		response := fmt.Sprintf(`{"paging":{"pageIndex":1,"pageSize":500,"total":%v},"issues":[%v]}`, total, strings.Join(issues, ","))
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+}
+
+func TestCreatesGitHubCheckWithBatchedAnnotations(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServerWithIssues(t, 121)
+	defer sonar.Close()
+
+	var runs []CheckRun
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var run CheckRun
+		if err := json.NewDecoder(r.Body).Decode(&run); err != nil {
+			t.Error(err)
+		}
+		runs = append(runs, run)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/owner/repo/check-runs":
+			w.WriteHeader(http.StatusCreated)
+			if _, err := w.Write([]byte(`{"id":4711}`)); err != nil {
+				t.Error(err)
+			}
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/owner/repo/check-runs/4711":
+		default:
+			t.Errorf("Unexpected %v request to %v", r.Method, r.URL.String())
+		}
+	}))
+	defer github.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage",
+    			"pull_request": "42"
+  			},
+  			"params": {
+				"github_check": {
+					"token": "secret",
+					"repository": "owner/repo",
+					"base_url": "%v"
+				}
+			}
+		}`, sonar.URL, github.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 3 {
+		t.Fatalf("Expected 3 requests, but got %v", len(runs))
+	}
+	first := runs[0]
+	if first.Name != "sonarqube" || first.HeadSha != "61cebf" || first.Status != "completed" || first.Conclusion != "failure" {
+		t.Errorf("Expected a failed check on the revision, but got %+v", first)
+	}
+	if first.Output.Title != "Quality gate ERROR, 121 new issues" {
+		t.Errorf("Expected title with the new issues, but got %v", first.Output.Title)
+	}
+	var batches []int
+	for _, r := range runs {
+		batches = append(batches, len(r.Output.Annotations))
+	}
+	if fmt.Sprint(batches) != "[50 50 20]" {
+		t.Errorf("Expected batches of [50 50 20] annotations, but got %v", batches)
+	}
+	expected := CheckAnnotation{
+		Path:            "src/main.go",
+		StartLine:       1,
+		EndLine:         2,
+		AnnotationLevel: "warning",
+		Message:         "Fix it",
+		Title:           "MAJOR BUG (go:S1)",
+	}
+	if first.Output.Annotations[0] != expected {
+		t.Errorf("Expected %+v, but got %+v", expected, first.Output.Annotations[0])
+	}
+}
+
+func TestStatesTruncatedAnnotationsInTheSummary(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonarHandler := sonarHandler(t)
+	var pages int
+	sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != issuesPath {
+			sonarHandler(w, r)
+			return
+		}
+		pages++
+		var issues []string
+		for i := 0; i < 500; i++ {
+			issues = append(issues, `{"component":"my:component:main.go","line":1,"message":"Fix it","severity":"MINOR"}`)
+		}
+		response := `{"paging":{"pageIndex":1,"pageSize":500,"total":12000},"issues":[` + strings.Join(issues, ",") + `]}`
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer sonar.Close()
+
+	var first CheckRun
+	var annotations int
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var run CheckRun
+		if err := json.NewDecoder(r.Body).Decode(&run); err != nil {
+			t.Error(err)
+		}
+		if r.Method == http.MethodPost {
+			first = run
+		}
+		annotations += len(run.Output.Annotations)
+		if _, err := w.Write([]byte(`{"id":4711}`)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer github.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage"
+  			},
+  			"params": {
+				"github_check": {
+					"token": "secret",
+					"repository": "owner/repo",
+					"base_url": "%v"
+				}
+			}
+		}`, sonar.URL, github.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if pages != 20 || annotations != 10000 {
+		t.Errorf("Expected 10000 annotations of 20 pages, but got %v of %v", annotations, pages)
+	}
+	if first.Output.Title != "Quality gate ERROR, 12000 new issues" {
+		t.Errorf("Expected title with all new issues, but got %v", first.Output.Title)
+	}
+	if expected := "Only the first 10000 of 12000 new issues are annotated."; !strings.Contains(first.Output.Summary, expected) {
+		t.Errorf("Expected summary to contain %v, but was %v", expected, first.Output.Summary)
+	}
+}
+
+func TestMapsQualityGateToCheckConclusion(t *testing.T) {
+	for status, expected := range map[string]string{"OK": "success", "ERROR": "failure", "NONE": "neutral"} {
+		if got := checkConclusion(status); got != expected {
+			t.Errorf("Expected %v to be %v, but got %v", status, expected, got)
+		}
+	}
+}
+
+func TestReturnsErrorIfGitHubCheckFails(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServerWithIssues(t, 1)
+	defer sonar.Close()
+
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}))
+	defer github.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage",
+    			"pull_request": "42"
+  			},
+  			"params": {
+				"github_check": {
+					"token": "secret",
+					"repository": "owner/repo",
+					"base_url": "%v"
+				}
+			}
+		}`, sonar.URL, github.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreatesGitHubComment(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	var created GitHubComment
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Expected bearer token, but got %v", auth)
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/owner/repo/issues/42/comments":
+			if _, err := w.Write([]byte(`[{"id":1,"body":"LGTM"}]`)); err != nil {
+				t.Error(err)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v3/repos/owner/repo/issues/42/comments":
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Error(err)
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("Unexpected %v request to %v", r.Method, r.URL.String())
+		}
+	}))
+	defer github.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs",
+    			"pull_request": "42"
+  			},
+  			"params": {
+				"github": {
+					"token": "secret",
+					"repository": "owner/repo",
+					"base_url": "%v/api/v3"
+				}
+			}
+		}`, sonar.URL, github.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"<!-- sonarqube:my:component -->",
+		"Quality gate of my:component is ERROR",
+		"New issues: 7",
+		"| coverage | 91.2 (+40.5) |",
+		"| new_bugs | 2 |",
+		"* ERROR new_bugs: 2",
+		"[Open in SonarQube](" + sonar.URL + "/dashboard?id=my%3Acomponent&pullRequest=42)",
+	} {
+		if !strings.Contains(created.Body, expected) {
+			t.Errorf("Expected comment to contain %v, but was %v", expected, created.Body)
+		}
+	}
+}
+
+func TestUpdatesGitHubCommentWithMarker(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	var pages []string
+	var updated bool
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			page := r.URL.Query().Get("page")
+			pages = append(pages, page)
+			var comments []string
+			if page == "1" {
+				for i := 0; i < githubCommentsPage; i++ {
+					comments = append(comments, fmt.Sprintf(`{"id":%v,"body":"comment"}`, i))
+				}
+			} else {
+				comments = append(comments, `{"id":4711,"body":"<!-- my-marker -->\nold"}`)
+			}
+			if _, err := w.Write([]byte("[" + strings.Join(comments, ",") + "]")); err != nil {
+				t.Error(err)
+			}
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/owner/repo/issues/comments/4711":
+			updated = true
+		default:
+			t.Errorf("Unexpected %v request to %v", r.Method, r.URL.String())
+		}
+	}))
+	defer github.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage"
+  			},
+  			"params": {
+				"github": {
+					"token": "secret",
+					"repository": "owner/repo",
+					"pull_request": "7",
+					"base_url": "%v",
+					"marker": "<!-- my-marker -->"
+				}
+			}
+		}`, sonar.URL, github.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(pages) != "[1 2]" {
+		t.Errorf("Expected pages [1 2] to be requested, but got %v", pages)
+	}
+	if !updated {
+		t.Error("Expected the existing comment to be updated")
+	}
+}
+
+func TestReturnsErrorIfGitHubCommentFails(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer github.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage"
+  			},
+  			"params": {
+				"github": {
+					"token": "secret",
+					"repository": "owner/repo",
+					"pull_request": "7",
+					"base_url": "%v"
+				}
+			}
+		}`, sonar.URL, github.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
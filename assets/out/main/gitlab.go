@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultGitLabURL = "https://gitlab.com"
+	gitlabNotesPage  = 100
+)
+
+type GitLabParams struct {
+	Token        string `json:"token"`
+	Project      string `json:"project"`
+	MergeRequest string `json:"merge_request"`
+	Sha          string `json:"sha"`
+	BaseURL      string `json:"base_url"`
+	Marker       string `json:"marker"`
+	StatusName   string `json:"status_name"`
+}
+
+type GitLabNote struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+type GitLabStatus struct {
+	State       string `json:"state"`
+	Name        string `json:"name"`
+	TargetURL   string `json:"target_url"`
+	Description string `json:"description"`
+}
+
+// notifyGitLab comments on the merge request and sets the status of the analysed commit.
+// The note carrying the marker is updated, so there is only a single note per component.
+func notifyGitLab(params GitLabParams, pullRequest string, report Report) error {
+	if params.MergeRequest != "" {
+		pullRequest = params.MergeRequest
+	}
+	sha := params.Sha
+	if sha == "" {
+		sha = report.Version["revision"]
+	}
+	if params.Token == "" || params.Project == "" {
+		return errors.New("gitlab token or project is missing")
+	}
+	if pullRequest == "" && sha == "" {
+		return errors.New("gitlab merge_request or sha is missing")
+	}
+
+	project := "/projects/" + url.PathEscape(params.Project)
+	if pullRequest != "" {
+		if err := noteOnGitLab(params, project+"/merge_requests/"+pullRequest+"/notes", report); err != nil {
+			return err
+		}
+	}
+	if sha != "" {
+		name := params.StatusName
+		if name == "" {
+			name = "sonarqube"
+		}
+		state := "success"
+		if report.QualityGate.Status == "ERROR" {
+			state = "failed"
+		}
+		status := GitLabStatus{
+			State:       state,
+			Name:        name,
+			TargetURL:   report.DashboardURL,
+			Description: "Quality gate " + report.QualityGate.Status,
+		}
+		if err := gitlabRequest(params, http.MethodPost, project+"/statuses/"+sha, status, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func noteOnGitLab(params GitLabParams, notes string, report Report) error {
+	marker := params.Marker
+	if marker == "" {
+		marker = "<!-- sonarqube:" + report.Component + " -->"
+	}
+	body := marker + "\n" + markdown(report)
+
+	for page := 1; ; page++ {
+		var existing []GitLabNote
+		path := notes + "?per_page=" + strconv.Itoa(gitlabNotesPage) + "&page=" + strconv.Itoa(page)
+		if err := gitlabRequest(params, http.MethodGet, path, nil, &existing); err != nil {
+			return err
+		}
+		for _, n := range existing {
+			if strings.Contains(n.Body, marker) {
+				path := notes + "/" + strconv.FormatInt(n.ID, 10)
+				return gitlabRequest(params, http.MethodPut, path, GitLabNote{Body: body}, nil)
+			}
+		}
+		if len(existing) < gitlabNotesPage {
+			break
+		}
+	}
+	return gitlabRequest(params, http.MethodPost, notes, GitLabNote{Body: body}, nil)
+}
+
+func gitlabRequest(params GitLabParams, method string, path string, in interface{}, out interface{}) error {
+	baseURL := params.BaseURL
+	if baseURL == "" {
+		baseURL = defaultGitLabURL
+	}
+	headers := map[string]string{
+		"PRIVATE-TOKEN": params.Token,
+	}
+	return sendJSON(method, strings.TrimSuffix(baseURL, "/")+"/api/v4"+path, headers, in, out)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpdatesGitLabNoteAndSetsCommitStatus(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	var note GitLabNote
+	var status GitLabStatus
+	gitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.Header.Get("PRIVATE-TOKEN"); token != "secret" {
+			t.Errorf("Expected private token, but got %v", token)
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.EscapedPath() == "/api/v4/projects/group%2Fservice/merge_requests/42/notes":
+			if _, err := w.Write([]byte(`[{"id":1,"body":"LGTM"},{"id":2,"body":"<!-- sonarqube:my:component -->\nold"}]`)); err != nil {
+				t.Error(err)
+			}
+		case r.Method == http.MethodPut && r.URL.EscapedPath() == "/api/v4/projects/group%2Fservice/merge_requests/42/notes/2":
+			if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+				t.Error(err)
+			}
+		case r.Method == http.MethodPost && r.URL.EscapedPath() == "/api/v4/projects/group%2Fservice/statuses/61cebf":
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				t.Error(err)
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("Unexpected %v request to %v", r.Method, r.URL.String())
+		}
+	}))
+	defer gitlab.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs",
+    			"pull_request": "42"
+  			},
+  			"params": {
+				"gitlab": {
+					"token": "secret",
+					"project": "group/service",
+					"base_url": "%v"
+				}
+			}
+		}`, sonar.URL, gitlab.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"New issues: 7", "| coverage | 91.2 (+40.5) |"} {
+		if !strings.Contains(note.Body, expected) {
+			t.Errorf("Expected note to contain %v, but was %v", expected, note.Body)
+		}
+	}
+	expected := GitLabStatus{
+		State:       "failed",
+		Name:        "sonarqube",
+		TargetURL:   sonar.URL + "/dashboard?id=my%3Acomponent&pullRequest=42",
+		Description: "Quality gate ERROR",
+	}
+	if status != expected {
+		t.Errorf("Expected %v, but got %v", expected, status)
+	}
+}
+
+func TestCreatesGitLabNoteWithoutMarker(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	var created bool
+	gitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			if _, err := w.Write([]byte(`[]`)); err != nil {
+				t.Error(err)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v4/projects/7/merge_requests/3/notes":
+			created = true
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v4/projects/7/statuses/abc":
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("Unexpected %v request to %v", r.Method, r.URL.String())
+		}
+	}))
+	defer gitlab.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage"
+  			},
+  			"params": {
+				"gitlab": {
+					"token": "secret",
+					"project": "7",
+					"merge_request": "3",
+					"sha": "abc",
+					"base_url": "%v"
+				}
+			}
+		}`, sonar.URL, gitlab.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Error("Expected a note to be created")
+	}
+}
+
+func TestReturnsErrorIfGitLabStatusFails(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	gitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer gitlab.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage"
+  			},
+  			"params": {
+				"gitlab": {
+					"token": "secret",
+					"project": "7",
+					"base_url": "%v"
+				}
+			}
+		}`, sonar.URL, gitlab.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
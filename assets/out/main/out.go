@@ -1,16 +1,123 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
 	"io"
+	"log"
 	"os"
 )
 
+const (
+	latestAction      = "latest"
+	waitAction        = "wait"
+	createEventAction = "create_event"
+)
+
+type OutRequest struct {
+	Source shared.Source `json:"source"`
+	Params OutParams     `json:"params"`
+}
+
+type OutParams struct {
+	Action        string             `json:"action"`
+	PullRequest   string             `json:"pull_request"`
+	ReportTask    string             `json:"report_task"`
+	Timeout       string             `json:"timeout"`
+	PollInterval  string             `json:"poll_interval"`
+	Analysis      string             `json:"analysis"`
+	EventName     string             `json:"event_name"`
+	EventFile     string             `json:"event_file"`
+	EventCategory string             `json:"event_category"`
+	Slack         *SlackParams       `json:"slack"`
+	Teams         *TeamsParams       `json:"teams"`
+	Email         *EmailParams       `json:"email"`
+	Webhook       *WebhookParams     `json:"webhook"`
+	GitHub        *GitHubParams      `json:"github"`
+	GitLab        *GitLabParams      `json:"gitlab"`
+	GitHubCheck   *GitHubCheckParams `json:"github_check"`
+}
+
+type OutResponse struct {
+	Version  shared.Version         `json:"version"`
+	Metadata []shared.MetadataField `json:"metadata,omitempty"`
+}
+
 func main() {
-	os.Exit(run(os.Stdout))
+	sourceDir := os.Args[1]
+	if err := run(os.Stdin, os.Stdout, sourceDir); err != nil {
+		log.Fatalln(err)
+	}
 }
 
-func run(outWriter io.Writer) int {
-	fmt.Fprintf(outWriter, "[]")
-	return 0
-}
\ No newline at end of file
+func run(stdIn io.Reader, stdOut io.Writer, sourceDir string) error {
+	var input OutRequest
+	if err := json.NewDecoder(stdIn).Decode(&input); err != nil {
+		return err
+	}
+
+	if !input.Source.Valid() {
+		return errors.New("mandatory field is missing")
+	}
+
+	client, err := shared.NewClient(input.Source)
+	if err != nil {
+		return err
+	}
+
+	pullRequest := input.Source.PullRequest
+	if input.Params.PullRequest != "" {
+		pullRequest = input.Params.PullRequest
+	}
+
+	var (
+		version  shared.Version
+		metadata []shared.MetadataField
+	)
+	switch input.Params.Action {
+	case "", latestAction:
+		result, err := client.SearchAnalyses(
+			input.Source.Component,
+			input.Source.Branch,
+			pullRequest,
+			"",
+			0,
+			1,
+		)
+		if err != nil {
+			return err
+		}
+		if version, err = latestVersion(result); err != nil {
+			return err
+		}
+	case waitAction:
+		if version, err = waitForTask(client, input, pullRequest, sourceDir); err != nil {
+			return err
+		}
+	case createEventAction:
+		if version, metadata, err = createEvent(client, input, pullRequest, sourceDir); err != nil {
+			return err
+		}
+	default:
+		return errors.New("unknown action " + input.Params.Action)
+	}
+
+	if err := notify(client, input, pullRequest, version, sourceDir); err != nil {
+		return err
+	}
+
+	return json.
+		NewEncoder(stdOut).
+		Encode(OutResponse{
+			Version:  version,
+			Metadata: append(version.Metadata(), metadata...),
+		})
+}
+
+func latestVersion(response shared.AnalysesResponse) (shared.Version, error) {
+	if len(response.Analyses) == 0 {
+		return nil, errors.New("no analysis found")
+	}
+	return response.Analyses[0].Version(), nil
+}
@@ -2,17 +2,301 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared/sharedtest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
-func TestDoesNothing(t *testing.T) {
-	stdout := &bytes.Buffer{}
-	status := run(stdout)
+const (
+	mockAnalysesResponse = `{
+		  "paging": {
+		    "pageIndex": 1,
+		    "pageSize": 1,
+		    "total": 12
+		  },
+		  "analyses": [
+		    {
+		      "key": "AWKa7VV9drIzrRaH-p_z",
+		      "date": "2018-04-06T14:27:06+0200",
+		      "projectVersion": "0.0.1-SNAPSHOT",
+		      "revision": "61cebf",
+		      "events": []
+		    }
+		  ]
+		}`
+	analysesPath = "/api/project_analyses/search"
+)
+
+func setup(t *testing.T) (stdIn *bytes.Buffer, stdOut *bytes.Buffer, tmpDir string) {
+	var err error
+	tmpDir, err = ioutil.TempDir("", "concourse-sonarqube")
+	if err != nil {
+		t.Error(err)
+	}
+	return &bytes.Buffer{}, &bytes.Buffer{}, tmpDir
+}
+
+func TestWritesVersionOfLatestAnalysisToStdOut(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		expected := analysesPath + "?branch=release%2F1.0&project=my%3Acomponent&ps=1"
+		if r.URL.String() != expected {
+			t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+		}
+		if _, err := w.Write([]byte(mockAnalysesResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"branch": "release/1.0"
+  			},
+  			"params": {}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
+	}
+	expectedResponse := `{"version":{"analysis":"AWKa7VV9drIzrRaH-p_z","date":"2018-04-06T14:27:06+0200","project_version":"0.0.1-SNAPSHOT","revision":"61cebf"},` +
+		`"metadata":[{"name":"analysis","value":"AWKa7VV9drIzrRaH-p_z"},{"name":"date","value":"2018-04-06T14:27:06+0200"},{"name":"project_version","value":"0.0.1-SNAPSHOT"},{"name":"revision","value":"61cebf"}]}` + "\n"
+	if stdOut.String() != expectedResponse {
+		t.Errorf("Expected content to be %v, but was %v", expectedResponse, stdOut.String())
+	}
+}
+
+func TestRequestsTheLatestAnalysisOfThePullRequest(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if pr := r.URL.Query().Get("pullRequest"); pr != "43" {
+			t.Errorf("Expected pull request 43, but got %v", pr)
+		}
+		if _, err := w.Write([]byte(mockAnalysesResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage",
+    			"pull_request": "42"
+  			},
+  			"params": {
+				"action": "latest",
+				"pull_request": "43"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Error(err)
+	}
 
-	if status != 0 {
-		t.Errorf("Expected status 0, but got %v", status)
+	if !called {
+		t.Error("Didn't call the remote service")
 	}
-	if stdout.String() != `[]` {
-		t.Errorf("Expected empty array, but got %v", stdout.String())
+}
+
+func TestAddsAuthenticationToTheRequest(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	authToken := "token"
+
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		gotAuth := r.Header.Get("Authorization")
+		expAuth := getBasicHeader(authToken)
+		if gotAuth != expAuth {
+			t.Errorf("Expected %v, but got %v", expAuth, gotAuth)
+		}
+		if _, err := w.Write([]byte(mockAnalysesResponse)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "%v",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			}
+		}`, s.URL, authToken))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Error(err)
+	}
+
+	if !called {
+		t.Error("Didn't call the remote service")
 	}
 }
+
+func TestTrustsCACertificateOfTheServer(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	s := httptest.NewTLSServer(sonarHandler(t))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage",
+    			"ca_cert": %q
+  			}
+		}`, s.URL, sharedtest.CertificatePEM(s.Certificate())))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReturnsErrorIfThereIsNoAnalysis(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":1,"total":0},"analyses":[]}`)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			}
+		}`, s.URL))
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || err.Error() != "no analysis found" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
+
+func TestReturnsErrorIfContentCouldNotBeFetched(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
+
+func TestReturnsErrorIfResponseIsMalformed(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(`<html>`)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
+
+func TestErrorsOnMalformedInput(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	stdIn.WriteString(`{"source": `)
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
+
+func TestErrorsOnUnknownAction(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	stdIn.WriteString(`{
+			"source": {
+    			"target": "https://my.sonar.server",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "delete"
+			}
+		}`)
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || err.Error() != "unknown action delete" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
+
+func TestErrorsWhenMandatoryFieldIsMissing(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	stdIn.WriteString(`{
+				"source": {
+    				"target": "https://my.sonar.server",
+    				"sonartoken": "token",
+    				"missing_component": "my-component",
+    				"metrics": "ncloc,complexity,violations,coverage"
+  				}
+			}`)
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || err.Error() != "mandatory field is missing" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
+
+func getBasicHeader(authToken string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(authToken+":"))
+}
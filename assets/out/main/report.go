@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// newIssuesMetric is requested in addition to the configured metrics for summarizing the new issues.
+const newIssuesMetric = "new_violations"
+
+// Report summarizes an analysis for notifications.
+type Report struct {
+	Component    string
+	Version      shared.Version
+	QualityGate  shared.ProjectStatus
+	Measures     []shared.Measure
+	NewIssues    string
+	DashboardURL string
+}
+
+// notify sends the report of the analysis to all configured targets.
+func notify(client *shared.Client, input OutRequest, pullRequest string, version shared.Version, sourceDir string) error {
+	if input.Params.Slack == nil && input.Params.Teams == nil && input.Params.Email == nil &&
+		input.Params.Webhook == nil && input.Params.GitHub == nil && input.Params.GitLab == nil &&
+		input.Params.GitHubCheck == nil {
+		return nil
+	}
+
+	report, err := getReport(client, input, pullRequest, version)
+	if err != nil {
+		return err
+	}
+
+	if input.Params.Slack != nil {
+		if err := notifySlack(*input.Params.Slack, report); err != nil {
+			return err
+		}
+	}
+	if input.Params.Teams != nil {
+		if err := notifyTeams(*input.Params.Teams, report); err != nil {
+			return err
+		}
+	}
+	if input.Params.Email != nil {
+		if err := notifyEmail(*input.Params.Email, report); err != nil {
+			return err
+		}
+	}
+	if input.Params.Webhook != nil {
+		if err := notifyWebhook(*input.Params.Webhook, report, sourceDir); err != nil {
+			return err
+		}
+	}
+	if input.Params.GitHub != nil {
+		if err := commentOnGitHub(*input.Params.GitHub, pullRequest, report); err != nil {
+			return err
+		}
+	}
+	if input.Params.GitLab != nil {
+		if err := notifyGitLab(*input.Params.GitLab, pullRequest, report); err != nil {
+			return err
+		}
+	}
+	if input.Params.GitHubCheck != nil {
+		if err := createGitHubCheck(client, *input.Params.GitHubCheck, input, pullRequest, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getReport(client *shared.Client, input OutRequest, pullRequest string, version shared.Version) (Report, error) {
+	report := Report{
+		Component:    input.Source.Component,
+		Version:      version,
+		DashboardURL: dashboardURL(input.Source.Target, input.Source.Component, input.Source.Branch, pullRequest),
+	}
+
+	metrics := input.Source.Metrics
+	if !containsMetric(metrics, newIssuesMetric) {
+		metrics += "," + newIssuesMetric
+	}
+	result, err := client.MeasuresOf(
+		input.Source.Component,
+		input.Source.Branch,
+		pullRequest,
+		metrics,
+		version,
+	)
+	if err != nil {
+		return report, err
+	}
+	var measures shared.MeasuresResponse
+	if err := json.Unmarshal(result, &measures); err != nil {
+		return report, err
+	}
+	report.Measures = inMetricsOrder(measures.Component.Measures, input.Source.Metrics)
+	for _, m := range measures.Component.Measures {
+		if m.Metric == newIssuesMetric {
+			report.NewIssues, _ = m.ActualValue()
+		}
+	}
+
+	qualityGate, err := client.QualityGate(input.Source.Component, "", "", version.Analysis())
+	if err != nil {
+		return report, err
+	}
+	var status shared.QualityGateResponse
+	if err := json.Unmarshal(qualityGate, &status); err != nil {
+		return report, err
+	}
+	report.QualityGate = status.ProjectStatus
+	return report, nil
+}
+
+// inMetricsOrder sorts the measures like the configured metrics, as SonarQube doesn't keep their order.
+func inMetricsOrder(measures []shared.Measure, metrics string) []shared.Measure {
+	byMetric := map[string]shared.Measure{}
+	for _, m := range measures {
+		byMetric[m.Metric] = m
+	}
+	var sorted []shared.Measure
+	for _, metric := range strings.Split(metrics, ",") {
+		if m, ok := byMetric[strings.TrimSpace(metric)]; ok {
+			sorted = append(sorted, m)
+		}
+	}
+	return sorted
+}
+
+func containsMetric(metrics string, metric string) bool {
+	for _, m := range strings.Split(metrics, ",") {
+		if strings.TrimSpace(m) == metric {
+			return true
+		}
+	}
+	return false
+}
+
+func dashboardURL(baseUrl string, component string, branch string, pullRequest string) string {
+	parameters := url.Values{}
+	parameters.Add("id", component)
+	shared.AddBranchOrPullRequest(parameters, branch, pullRequest)
+	return strings.TrimSuffix(baseUrl, "/") + "/dashboard?" + parameters.Encode()
+}
+
+// markdown renders the report as a table of the metrics and the failing conditions of the quality gate.
+func markdown(report Report) string {
+	var b strings.Builder
+	b.WriteString("### SonarQube: Quality gate of " + report.Component + " is " + report.QualityGate.Status + "\n\n")
+	if report.NewIssues != "" {
+		b.WriteString("New issues: " + report.NewIssues + "\n\n")
+	}
+	b.WriteString("| Metric | Value |\n|---|---|\n")
+	for _, m := range report.Measures {
+		b.WriteString("| " + m.Metric + " | " + formatMeasure(m) + " |\n")
+	}
+	var failing []string
+	for _, c := range report.QualityGate.Conditions {
+		if c.Status != "OK" {
+			failing = append(failing, "* "+c.Status+" "+c.MetricKey+": "+c.ActualValue)
+		}
+	}
+	if len(failing) > 0 {
+		b.WriteString("\nFailing conditions:\n" + strings.Join(failing, "\n") + "\n")
+	}
+	b.WriteString("\n[Open in SonarQube](" + report.DashboardURL + ")\n")
+	return b.String()
+}
+
+// formatMeasure shows the value together with its new code delta, e.g. "91.2 (+40.5)".
+func formatMeasure(m shared.Measure) string {
+	value, ok := m.ActualValue()
+	if !ok {
+		value = "-"
+	}
+	delta, ok := m.NewCodeValue()
+	if !ok || m.Value == "" {
+		return value
+	}
+	if _, err := strconv.ParseFloat(delta, 64); err == nil && !strings.HasPrefix(delta, "-") {
+		delta = "+" + delta
+	}
+	return value + " (" + delta + ")"
+}
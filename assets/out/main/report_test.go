@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	measuresPath         = "/api/measures/component"
+	qualityGatePath      = "/api/qualitygates/project_status"
+	mockMeasuresResponse = `{
+		  "component": {
+		    "key": "my:component",
+		    "measures": [
+		      {"metric": "violations", "value": "5", "periods": [{"index": 1, "value": "-6"}]},
+		      {"metric": "coverage", "value": "91.2", "periods": [{"index": 1, "value": "40.5"}]},
+		      {"metric": "new_bugs", "period": {"index": 1, "value": "2"}},
+		      {"metric": "new_violations", "period": {"index": 1, "value": "7"}}
+		    ]
+		  }
+		}`
+	mockQualityGateResponse = `{
+		  "projectStatus": {
+		    "status": "ERROR",
+		    "conditions": [
+		      {"status": "ERROR", "metricKey": "new_bugs", "comparator": "GT", "errorThreshold": "0", "actualValue": "2"},
+		      {"status": "OK", "metricKey": "new_coverage", "comparator": "LT", "errorThreshold": "80", "actualValue": "85.1"}
+		    ]
+		  }
+		}`
+)
+
+// newSonarServer serves the latest analysis together with its measures and quality gate.
+func newSonarServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(sonarHandler(t))
+}
+
+func sonarHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch r.URL.Path {
+		case analysesPath:
+			response = mockAnalysesResponse
+		case measuresPath:
+			if metrics := r.URL.Query().Get("metricKeys"); !strings.HasSuffix(metrics, ",new_violations") {
+				t.Errorf("Expected new issues to be requested, but got %v", metrics)
+			}
+			response = mockMeasuresResponse
+		case qualityGatePath:
+			if analysis := r.URL.Query().Get("analysisId"); analysis != "AWKa7VV9drIzrRaH-p_z" {
+				t.Errorf("Expected quality gate of the analysis, but got %v", analysis)
+			}
+			response = mockQualityGateResponse
+		default:
+			t.Errorf("Unexpected request to %v", r.URL.String())
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFormatsMeasuresWithNewCodeDelta(t *testing.T) {
+	for _, c := range []struct {
+		measure  shared.Measure
+		expected string
+	}{
+		{shared.Measure{Metric: "coverage", Value: "91.2", Periods: []shared.Period{{Index: 1, Value: "40.5"}}}, "91.2 (+40.5)"},
+		{shared.Measure{Metric: "violations", Value: "5", Period: &shared.Period{Index: 1, Value: "-6"}}, "5 (-6)"},
+		{shared.Measure{Metric: "new_bugs", Period: &shared.Period{Index: 1, Value: "2"}}, "2"},
+		{shared.Measure{Metric: "ncloc", Value: "795"}, "795"},
+		{shared.Measure{Metric: "missing"}, "-"},
+	} {
+		if got := formatMeasure(c.measure); got != c.expected {
+			t.Errorf("Expected %v to be formatted as %v, but got %v", c.measure.Metric, c.expected, got)
+		}
+	}
+}
+
+func TestBuildsDashboardURL(t *testing.T) {
+	got := dashboardURL("https://my.sonar.server/sonar/", "my:component", "release/1.0", "")
+	expected := "https://my.sonar.server/sonar/dashboard?branch=release%2F1.0&id=my%3Acomponent"
+	if got != expected {
+		t.Errorf("Expected %v, but got %v", expected, got)
+	}
+}
+
+func TestKeepsOrderOfConfiguredMetrics(t *testing.T) {
+	measures := []shared.Measure{{Metric: "violations"}, {Metric: "coverage"}, {Metric: "ncloc"}}
+	sorted := inMetricsOrder(measures, "ncloc, coverage,violations,complexity")
+	if len(sorted) != 3 || sorted[0].Metric != "ncloc" || sorted[1].Metric != "coverage" || sorted[2].Metric != "violations" {
+		t.Errorf("Expected measures in order of the metrics, but got %v", sorted)
+	}
+}
+
+func TestReportsMeasuresAndQualityGateOfTheSameAnalysis(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch r.URL.Path {
+		case analysesPath:
+			response = `{"analyses":[
+				{"key":"AWKa7VV9drIzrRaH-p_z","date":"2018-04-06T14:27:06+0200"},
+				{"key":"AWKQ3B6rdrIzrRaH-Rt3","date":"2018-04-04T15:32:28+0200"}]}`
+		case createEventPath:
+			response = `{"event":{"key":"AU-TpxcA-iU5OvuD2FL5","analysis":"AWKQ3B6rdrIzrRaH-Rt3","category":"OTHER","name":"shipped"}}`
+		case "/api/measures/search_history":
+			if date := r.URL.Query().Get("to"); date != "2018-04-04T15:32:28+0200" {
+				t.Errorf("Expected the history at the date of the analysis, but got %v", date)
+			}
+			response = `{"measures":[{"metric":"coverage","history":[{"date":"2018-04-04T15:32:28+0200","value":"50.7"}]}]}`
+		case measuresPath:
+			t.Error("Expected the measures of the latest analysis not to be requested")
+		case qualityGatePath:
+			if analysis := r.URL.Query().Get("analysisId"); analysis != "AWKQ3B6rdrIzrRaH-Rt3" {
+				t.Errorf("Expected quality gate of the analysis, but got %v", analysis)
+			}
+			response = mockQualityGateResponse
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer sonar.Close()
+
+	var message SlackMessage
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer slack.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage"
+  			},
+  			"params": {
+				"action": "create_event",
+				"analysis": "AWKQ3B6rdrIzrRaH-Rt3",
+				"event_name": "shipped",
+				"slack": {
+					"webhook_url": "%v"
+				}
+			}
+		}`, sonar.URL, slack.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(message.Attachments) != 1 {
+		t.Fatalf("Expected one attachment, but got %v", message.Attachments)
+	}
+	expected := []SlackField{{Title: "coverage", Value: "50.7", Short: true}}
+	if fmt.Sprint(message.Attachments[0].Fields) != fmt.Sprint(expected) {
+		t.Errorf("Expected fields %v, but got %v", expected, message.Attachments[0].Fields)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+type SlackParams struct {
+	WebhookURL string `json:"webhook_url"`
+	Channel    string `json:"channel"`
+}
+
+type SlackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments"`
+}
+
+type SlackAttachment struct {
+	Color     string       `json:"color"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link"`
+	Fields    []SlackField `json:"fields"`
+}
+
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+var slackColors = map[string]string{
+	"OK":    "good",
+	"WARN":  "warning",
+	"ERROR": "danger",
+}
+
+func notifySlack(params SlackParams, report Report) error {
+	if params.WebhookURL == "" {
+		return errors.New("slack webhook_url is missing")
+	}
+
+	var fields []SlackField
+	for _, m := range report.Measures {
+		fields = append(fields, SlackField{Title: m.Metric, Value: formatMeasure(m), Short: true})
+	}
+	message := SlackMessage{
+		Channel: params.Channel,
+		Text:    "Quality gate of " + report.Component + " is " + report.QualityGate.Status,
+		Attachments: []SlackAttachment{{
+			Color:     slackColors[report.QualityGate.Status],
+			Title:     report.Component,
+			TitleLink: report.DashboardURL,
+			Fields:    fields,
+		}},
+	}
+	return sendJSON(http.MethodPost, params.WebhookURL, nil, message, nil)
+}
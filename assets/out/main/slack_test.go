@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendsSlackNotification(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	var message SlackMessage
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected json, but got %v", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer slack.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"slack": {
+					"webhook_url": "%v",
+					"channel": "#builds"
+				}
+			}
+		}`, sonar.URL, slack.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.Channel != "#builds" {
+		t.Errorf("Expected channel #builds, but got %v", message.Channel)
+	}
+	if message.Text != "Quality gate of my:component is ERROR" {
+		t.Errorf("Expected quality gate status, but got %v", message.Text)
+	}
+	if len(message.Attachments) != 1 {
+		t.Fatalf("Expected one attachment, but got %v", message.Attachments)
+	}
+	attachment := message.Attachments[0]
+	if attachment.Color != "danger" {
+		t.Errorf("Expected color danger, but got %v", attachment.Color)
+	}
+	if attachment.TitleLink != sonar.URL+"/dashboard?id=my%3Acomponent" {
+		t.Errorf("Expected dashboard link, but got %v", attachment.TitleLink)
+	}
+	expected := []SlackField{
+		{Title: "coverage", Value: "91.2 (+40.5)", Short: true},
+		{Title: "violations", Value: "5 (-6)", Short: true},
+		{Title: "new_bugs", Value: "2", Short: true},
+	}
+	if fmt.Sprint(attachment.Fields) != fmt.Sprint(expected) {
+		t.Errorf("Expected fields %v, but got %v", expected, attachment.Fields)
+	}
+}
+
+func TestReturnsErrorIfSlackRejectsNotification(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer slack.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"slack": {
+					"webhook_url": "%v"
+				}
+			}
+		}`, sonar.URL, slack.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
+
+func TestReturnsErrorIfSlackWebhookIsMissing(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"slack": {}
+			}
+		}`, sonar.URL))
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || err.Error() != "slack webhook_url is missing" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
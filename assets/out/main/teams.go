@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+type TeamsParams struct {
+	WebhookURL string `json:"webhook_url"`
+}
+
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+type TeamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     AdaptiveCard `json:"content"`
+}
+
+type AdaptiveCard struct {
+	Schema  string           `json:"$schema"`
+	Type    string           `json:"type"`
+	Version string           `json:"version"`
+	Body    []AdaptiveBlock  `json:"body"`
+	Actions []AdaptiveAction `json:"actions"`
+}
+
+type AdaptiveBlock struct {
+	Type   string         `json:"type"`
+	Text   string         `json:"text,omitempty"`
+	Weight string         `json:"weight,omitempty"`
+	Size   string         `json:"size,omitempty"`
+	Color  string         `json:"color,omitempty"`
+	Facts  []AdaptiveFact `json:"facts,omitempty"`
+}
+
+type AdaptiveFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type AdaptiveAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+var teamsColors = map[string]string{
+	"OK":    "Good",
+	"WARN":  "Warning",
+	"ERROR": "Attention",
+}
+
+func notifyTeams(params TeamsParams, report Report) error {
+	if params.WebhookURL == "" {
+		return errors.New("teams webhook_url is missing")
+	}
+
+	var facts []AdaptiveFact
+	for _, m := range report.Measures {
+		facts = append(facts, AdaptiveFact{Title: m.Metric, Value: formatMeasure(m)})
+	}
+	message := TeamsMessage{
+		Type: "message",
+		Attachments: []TeamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: AdaptiveCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body: []AdaptiveBlock{
+					{
+						Type:   "TextBlock",
+						Text:   "Quality gate of " + report.Component + " is " + report.QualityGate.Status,
+						Weight: "Bolder",
+						Size:   "Medium",
+						Color:  teamsColors[report.QualityGate.Status],
+					},
+					{Type: "FactSet", Facts: facts},
+				},
+				Actions: []AdaptiveAction{{
+					Type:  "Action.OpenUrl",
+					Title: "Open in SonarQube",
+					URL:   report.DashboardURL,
+				}},
+			},
+		}},
+	}
+	return sendJSON(http.MethodPost, params.WebhookURL, nil, message, nil)
+}
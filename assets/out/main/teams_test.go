@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendsTeamsNotification(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	var message TeamsMessage
+	teams := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer teams.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"teams": {
+					"webhook_url": "%v"
+				}
+			}
+		}`, sonar.URL, teams.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.Type != "message" || len(message.Attachments) != 1 {
+		t.Fatalf("Expected a message with one attachment, but got %v", message)
+	}
+	attachment := message.Attachments[0]
+	if attachment.ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Errorf("Expected an adaptive card, but got %v", attachment.ContentType)
+	}
+	card := attachment.Content
+	if card.Type != "AdaptiveCard" || len(card.Body) != 2 {
+		t.Fatalf("Expected an adaptive card with title and facts, but got %v", card)
+	}
+	title := card.Body[0]
+	if title.Text != "Quality gate of my:component is ERROR" || title.Color != "Attention" {
+		t.Errorf("Expected the quality gate in attention, but got %v in %v", title.Text, title.Color)
+	}
+	expected := []AdaptiveFact{
+		{Title: "coverage", Value: "91.2 (+40.5)"},
+		{Title: "violations", Value: "5 (-6)"},
+		{Title: "new_bugs", Value: "2"},
+	}
+	if fmt.Sprint(card.Body[1].Facts) != fmt.Sprint(expected) {
+		t.Errorf("Expected facts %v, but got %v", expected, card.Body[1].Facts)
+	}
+	if len(card.Actions) != 1 || card.Actions[0].URL != sonar.URL+"/dashboard?id=my%3Acomponent" {
+		t.Errorf("Expected a link to the dashboard, but got %v", card.Actions)
+	}
+}
+
+func TestReturnsErrorIfTeamsWebhookIsMissing(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"teams": {}
+			}
+		}`, sonar.URL))
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || err.Error() != "teams webhook_url is missing" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout      = 10 * time.Minute
+	defaultPollInterval = 5 * time.Second
+	analysesPageSize    = 100
+)
+
+// waitForTask polls the Compute Engine task of the scanner's report until it's
+// done and returns the version of the analysis it created.
+func waitForTask(client *shared.Client, input OutRequest, pullRequest string, sourceDir string) (shared.Version, error) {
+	if input.Params.ReportTask == "" {
+		return nil, errors.New("report_task is missing")
+	}
+	timeout, err := parseDuration(input.Params.Timeout, defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	pollInterval, err := parseDuration(input.Params.PollInterval, defaultPollInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	taskID, err := readTaskID(filepath.Join(sourceDir, input.Params.ReportTask))
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	var task shared.Task
+	for {
+		response, err := client.Task(taskID)
+		if err != nil {
+			return nil, err
+		}
+		task = response.Task
+		if task.Status != "PENDING" && task.Status != "IN_PROGRESS" {
+			break
+		}
+		if time.Now().Add(pollInterval).After(deadline) {
+			return nil, errors.New("timed out waiting for task " + taskID + " with status " + task.Status)
+		}
+		time.Sleep(pollInterval)
+	}
+
+	if task.Status != "SUCCESS" {
+		return nil, errors.New("task " + taskID + " finished with status " + task.Status + ": " + task.ErrorMessage)
+	}
+
+	branch := input.Source.Branch
+	if task.Branch != "" || task.PullRequest != "" {
+		branch, pullRequest = task.Branch, task.PullRequest
+	}
+	return findAnalysis(client, input.Source.Component, branch, pullRequest, task.AnalysisID)
+}
+
+func parseDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// readTaskID reads the ceTaskId out of the report-task.txt written by the scanner.
+func readTaskID(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if found && key == "ceTaskId" {
+			return value, nil
+		}
+	}
+	return "", errors.New("ceTaskId is missing in " + path)
+}
+
+// findAnalysis pages through the analyses of the component until it finds the given one.
+func findAnalysis(client *shared.Client, component string, branch string, pullRequest string, analysis string) (shared.Version, error) {
+	for page := 1; ; page++ {
+		response, err := client.SearchAnalyses(component, branch, pullRequest, "", page, analysesPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range response.Analyses {
+			if a.Key == analysis {
+				return a.Version(), nil
+			}
+		}
+		if len(response.Analyses) == 0 || page*analysesPageSize >= response.Paging.Total {
+			return nil, errors.New("analysis " + analysis + " not found")
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	taskPath   = "/api/ce/task"
+	reportTask = `projectKey=my:component
+serverUrl=https://my.sonar.server
+serverVersion=9.9.0.65466
+dashboardUrl=https://my.sonar.server/dashboard?id=my%3Acomponent
+ceTaskId=AVAn5RKqYwETbXvgas-I
+ceTaskUrl=https://my.sonar.server/api/ce/task?id=AVAn5RKqYwETbXvgas-I
+`
+)
+
+func writeReportTask(t *testing.T, dir string) {
+	if err := os.MkdirAll(filepath.Join(dir, "scan"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "scan", "report-task.txt"), []byte(reportTask), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitsForTaskAndWritesVersionOfItsAnalysis(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+	writeReportTask(t, tmpDir)
+
+	statuses := []string{"PENDING", "IN_PROGRESS", "SUCCESS"}
+	var polls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response string
+		switch r.URL.Path {
+		case taskPath:
+			if id := r.URL.Query().Get("id"); id != "AVAn5RKqYwETbXvgas-I" {
+				t.Errorf("Expected task AVAn5RKqYwETbXvgas-I, but got %v", id)
+			}
+			response = fmt.Sprintf(`{"task":{"id":"AVAn5RKqYwETbXvgas-I","status":"%v","analysisId":"AWKQ3B6rdrIzrRaH-Rt3","branch":"release/1.0","branchType":"BRANCH"}}`,
+				statuses[polls])
+			polls++
+		case analysesPath:
+			expected := analysesPath + "?branch=release%2F1.0&p=1&project=my%3Acomponent&ps=100"
+			if r.URL.String() != expected {
+				t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+			}
+			response = `{"analyses":[
+				{"key":"AWKa7VV9drIzrRaH-p_z","date":"2018-04-06T14:27:06+0200"},
+				{"key":"AWKQ3B6rdrIzrRaH-Rt3","date":"2018-04-04T15:32:28+0200","revision":"61cebf"}]}`
+		}
+		if _, err := w.Write([]byte(response)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "wait",
+				"report_task": "scan/report-task.txt",
+				"poll_interval": "1ms"
+			}
+		}`, s.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if polls != 3 {
+		t.Errorf("Expected 3 polls, but got %v", polls)
+	}
+	expectedVersion := `{"version":{"analysis":"AWKQ3B6rdrIzrRaH-Rt3","date":"2018-04-04T15:32:28+0200","revision":"61cebf"}`
+	if !strings.HasPrefix(stdOut.String(), expectedVersion) {
+		t.Errorf("Expected version %v, but was %v", expectedVersion, stdOut.String())
+	}
+}
+
+func TestReturnsErrorIfTaskFailed(t *testing.T) {
+	for _, status := range []string{"FAILED", "CANCELED"} {
+		stdIn, stdOut, tmpDir := setup(t)
+		writeReportTask(t, tmpDir)
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response := fmt.Sprintf(`{"task":{"id":"AVAn5RKqYwETbXvgas-I","status":"%v","errorMessage":"Broken report"}}`, status)
+			if _, err := w.Write([]byte(response)); err != nil {
+				t.Error(err)
+			}
+		}))
+
+		stdIn.WriteString(fmt.Sprintf(`{
+				"source": {
+    				"target": "%v",
+					"sonartoken": "token",
+    				"component": "my:component",
+    				"metrics": "ncloc,complexity,violations,coverage"
+  				},
+  				"params": {
+					"action": "wait",
+					"report_task": "scan/report-task.txt"
+				}
+			}`, s.URL))
+
+		err := run(stdIn, stdOut, tmpDir)
+		s.Close()
+		expected := "task AVAn5RKqYwETbXvgas-I finished with status " + status + ": Broken report"
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %v, but was %v", expected, err)
+		}
+	}
+}
+
+func TestReturnsErrorIfTaskTimesOut(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+	writeReportTask(t, tmpDir)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(`{"task":{"id":"AVAn5RKqYwETbXvgas-I","status":"IN_PROGRESS"}}`)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "wait",
+				"report_task": "scan/report-task.txt",
+				"timeout": "20ms",
+				"poll_interval": "5ms"
+			}
+		}`, s.URL))
+
+	err := run(stdIn, stdOut, tmpDir)
+	expected := "timed out waiting for task AVAn5RKqYwETbXvgas-I with status IN_PROGRESS"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %v, but was %v", expected, err)
+	}
+}
+
+func TestReturnsErrorIfReportTaskIsMissing(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	stdIn.WriteString(`{
+			"source": {
+    			"target": "https://my.sonar.server",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "wait"
+			}
+		}`)
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || err.Error() != "report_task is missing" {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
+
+func TestReturnsErrorIfReportTaskHasNoTask(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "report-task.txt"), []byte("projectKey=my:component\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	stdIn.WriteString(`{
+			"source": {
+    			"target": "https://my.sonar.server",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "ncloc,complexity,violations,coverage"
+  			},
+  			"params": {
+				"action": "wait",
+				"report_task": "report-task.txt"
+			}
+		}`)
+
+	err := run(stdIn, stdOut, tmpDir)
+	if err == nil || !strings.HasPrefix(err.Error(), "ceTaskId is missing") {
+		t.Errorf("Expected error to occure, but was %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+type WebhookParams struct {
+	URL          string            `json:"url"`
+	Method       string            `json:"method"`
+	Headers      map[string]string `json:"headers"`
+	Template     string            `json:"template"`
+	TemplateFile string            `json:"template_file"`
+}
+
+// WebhookData is available within the template of a webhook.
+type WebhookData struct {
+	Report
+	Build BuildMetadata
+}
+
+// BuildMetadata is read from the environment Concourse provides to resources.
+type BuildMetadata struct {
+	ID           string
+	Name         string
+	JobName      string
+	PipelineName string
+	TeamName     string
+	URL          string
+}
+
+func buildMetadata() BuildMetadata {
+	build := BuildMetadata{
+		ID:           os.Getenv("BUILD_ID"),
+		Name:         os.Getenv("BUILD_NAME"),
+		JobName:      os.Getenv("BUILD_JOB_NAME"),
+		PipelineName: os.Getenv("BUILD_PIPELINE_NAME"),
+		TeamName:     os.Getenv("BUILD_TEAM_NAME"),
+	}
+	if externalURL := os.Getenv("ATC_EXTERNAL_URL"); externalURL != "" && build.ID != "" {
+		build.URL = strings.TrimSuffix(externalURL, "/") + "/builds/" + build.ID
+	}
+	return build
+}
+
+var webhookFuncs = template.FuncMap{
+	"format": formatMeasure,
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+func notifyWebhook(params WebhookParams, report Report, sourceDir string) error {
+	if params.URL == "" {
+		return errors.New("webhook url is missing")
+	}
+	text := params.Template
+	if params.TemplateFile != "" {
+		content, err := ioutil.ReadFile(filepath.Join(sourceDir, params.TemplateFile))
+		if err != nil {
+			return err
+		}
+		text = string(content)
+	}
+	if text == "" {
+		return errors.New("webhook template or template_file is missing")
+	}
+	method := params.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	tmpl, err := template.New("webhook").Funcs(webhookFuncs).Parse(text)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, WebhookData{Report: report, Build: buildMetadata()}); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, params.URL, &body)
+	if err != nil {
+		return err
+	}
+	for k, v := range params.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		response, _ := ioutil.ReadAll(resp.Body)
+		return errors.New("Status " + strconv.Itoa(resp.StatusCode) + " : " + string(response))
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSendsTemplatedWebhook(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+	t.Setenv("BUILD_ID", "1234")
+	t.Setenv("BUILD_JOB_NAME", "scan")
+	t.Setenv("BUILD_PIPELINE_NAME", "service")
+	t.Setenv("ATC_EXTERNAL_URL", "https://ci.example.com/")
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	var method, token, body string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		token = r.Header.Get("X-Token")
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		body = string(content)
+	}))
+	defer hook.Close()
+
+	template := `{"status":{{json .QualityGate.Status}},"job":"{{.Build.PipelineName}}/{{.Build.JobName}}","build":"{{.Build.URL}}",` +
+		`"metrics":[{{range $i, $m := .Measures}}{{if $i}},{{end}}{{json (format $m)}}{{end}}],"link":{{json .DashboardURL}}}`
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "hook.tmpl"), []byte(template), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"webhook": {
+					"url": "%v",
+					"method": "PUT",
+					"headers": {"X-Token": "secret"},
+					"template_file": "hook.tmpl"
+				}
+			}
+		}`, sonar.URL, hook.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPut {
+		t.Errorf("Expected PUT, but got %v", method)
+	}
+	if token != "secret" {
+		t.Errorf("Expected custom header, but got %v", token)
+	}
+	expected := `{"status":"ERROR","job":"service/scan","build":"https://ci.example.com/builds/1234",` +
+		`"metrics":["91.2 (+40.5)","5 (-6)","2"],"link":"` + sonar.URL + `/dashboard?id=my%3Acomponent"}`
+	if body != expected {
+		t.Errorf("Expected %v, but got %v", expected, body)
+	}
+}
+
+func TestPostsInlineTemplateByDefault(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	var method, body string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		body = string(content)
+	}))
+	defer hook.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"webhook": {
+					"url": "%v",
+					"template": "{{.Component}} is {{.QualityGate.Status}}"
+				}
+			}
+		}`, sonar.URL, hook.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPost {
+		t.Errorf("Expected POST, but got %v", method)
+	}
+	if body != "my:component is ERROR" {
+		t.Errorf("Expected rendered template, but got %v", body)
+	}
+}
+
+func TestReturnsErrorOnInvalidWebhookTemplate(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"webhook": {
+					"url": "https://hooks.example.com",
+					"template": "{{.Unknown"
+				}
+			}
+		}`, sonar.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
+
+func TestReturnsErrorIfWebhookFails(t *testing.T) {
+	stdIn, stdOut, tmpDir := setup(t)
+
+	sonar := newSonarServer(t)
+	defer sonar.Close()
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer hook.Close()
+
+	stdIn.WriteString(fmt.Sprintf(`{
+			"source": {
+    			"target": "%v",
+				"sonartoken": "token",
+    			"component": "my:component",
+    			"metrics": "coverage,violations,new_bugs"
+  			},
+  			"params": {
+				"webhook": {
+					"url": "%v",
+					"template": "{{.Component}}"
+				}
+			}
+		}`, sonar.URL, hook.URL))
+
+	if err := run(stdIn, stdOut, tmpDir); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
@@ -0,0 +1,381 @@
+package shared
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetries   = 2
+	defaultRetryWait = time.Second
+)
+
+// Client calls the Web API of SonarQube. Authentication, TLS and retries are handled here,
+// so that check, in and out only build the parameters of the endpoints.
+type Client struct {
+	BaseURL    string
+	Token      string
+	AuthMode   string
+	Username   string
+	Password   string
+	Headers    map[string]string
+	HTTPClient *http.Client
+	// Retries is the number of retries of reading requests, which failed temporarily.
+	Retries   int
+	RetryWait time.Duration
+}
+
+// Error is returned when SonarQube responds with a status other than 200.
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return "Status " + strconv.Itoa(e.StatusCode) + " : " + e.Body
+}
+
+// temporary are failures, which might be gone on the next try, e.g. while SonarQube is restarting.
+func (e *Error) temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func NewClient(source Source) (*Client, error) {
+	switch source.AuthMode {
+	case "", TokenAuth, BearerAuth, BasicAuth:
+	default:
+		return nil, errors.New("unknown auth_mode " + source.AuthMode)
+	}
+	tlsConfig, err := newTLSConfig(source)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		BaseURL:    source.Target,
+		Token:      source.SonarToken,
+		AuthMode:   source.AuthMode,
+		Username:   source.Username,
+		Password:   source.Password,
+		Headers:    source.Headers,
+		HTTPClient: &http.Client{Transport: transport},
+		Retries:    defaultRetries,
+		RetryWait:  defaultRetryWait,
+	}, nil
+}
+
+// newTLSConfig trusts the CA certificates in addition to the ones of the system,
+// so that the image doesn't need to be rebuilt for an internal CA.
+func newTLSConfig(source Source) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: source.InsecureSkipVerify}
+	if source.CACert != "" {
+		pool, err := CertPool(source.CACert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if source.ClientCert != "" || source.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(source.ClientCert), []byte(source.ClientKey))
+		if err != nil {
+			return nil, errors.New("invalid client_cert or client_key: " + err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// CertPool adds the PEM encoded CA certificates to the ones of the system.
+func CertPool(caCert string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM([]byte(caCert)) {
+		return nil, errors.New("ca_cert doesn't contain a PEM encoded certificate")
+	}
+	return pool, nil
+}
+
+// Get returns the body of the response as it is, for writing it to a file.
+func (c *Client) Get(path string, query url.Values) ([]byte, error) {
+	var body []byte
+	var err error
+	wait := c.RetryWait
+	for try := 0; ; try++ {
+		body, err = c.do(http.MethodGet, path, query, nil)
+		if err == nil || try >= c.Retries || !isTemporary(err) {
+			return body, err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// GetJSON decodes the response into out.
+func (c *Client) GetJSON(path string, query url.Values, out interface{}) error {
+	body, err := c.Get(path, query)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+// PostForm isn't retried, as it changes data in SonarQube.
+func (c *Client) PostForm(path string, form url.Values, out interface{}) error {
+	body, err := c.do(http.MethodPost, path, nil, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (c *Client) do(method string, path string, query url.Values, body io.Reader) ([]byte, error) {
+	fullUrl, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	fullUrl.Path += path
+	fullUrl.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, fullUrl.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	c.authenticate(req)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	response, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, &Error{Method: method, URL: fullUrl.String(), StatusCode: resp.StatusCode, Body: string(response)}
+	}
+	return response, nil
+}
+
+// authenticate adds the custom headers last, so that they can replace the credentials, e.g. behind an SSO proxy.
+func (c *Client) authenticate(req *http.Request) {
+	switch c.AuthMode {
+	case BearerAuth:
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case BasicAuth:
+		req.SetBasicAuth(c.Username, c.Password)
+	default:
+		req.SetBasicAuth(c.Token, "")
+	}
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// isTemporary retries failing connections and timeouts as well, as they happen while SonarQube is unreachable.
+// Failures of TLS aren't retried, as they won't be gone on the next try.
+func isTemporary(err error) bool {
+	var sonarErr *Error
+	if errors.As(err, &sonarErr) {
+		return sonarErr.temporary()
+	}
+	// A refused connection means nothing listens on the target, which won't change while retrying.
+	var netErr *net.OpError
+	if errors.As(err, &netErr) && netErr.Op == "dial" {
+		return !errors.Is(err, syscall.ECONNREFUSED)
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Timeout()
+}
+
+// optional adds the parameter only when it's set, as SonarQube rejects empty values of e.g. branch.
+func optional(query url.Values, key string, value string) {
+	if value != "" {
+		query.Add(key, value)
+	}
+}
+
+// AddBranchOrPullRequest prefers the pull request, as SonarQube rejects a branch together with a pull request.
+// A pull request given by params of in or out would otherwise be combined with the branch of the source.
+func AddBranchOrPullRequest(query url.Values, branch string, pullRequest string) {
+	if pullRequest != "" {
+		query.Add("pullRequest", pullRequest)
+	} else {
+		optional(query, "branch", branch)
+	}
+}
+
+func (c *Client) SearchAnalyses(project string, branch string, pullRequest string, from string, page int, pageSize int) (AnalysesResponse, error) {
+	query := url.Values{}
+	query.Add("project", project)
+	AddBranchOrPullRequest(query, branch, pullRequest)
+	optional(query, "from", from)
+	if page > 0 {
+		query.Add("p", strconv.Itoa(page))
+	}
+	query.Add("ps", strconv.Itoa(pageSize))
+	var response AnalysesResponse
+	err := c.GetJSON("/api/project_analyses/search", query, &response)
+	return response, err
+}
+
+func (c *Client) CreateEvent(analysis string, name string, category string) (EventResponse, error) {
+	form := url.Values{}
+	form.Add("analysis", analysis)
+	form.Add("name", name)
+	optional(form, "category", category)
+	var response EventResponse
+	err := c.PostForm("/api/project_analyses/create_event", form, &response)
+	return response, err
+}
+
+func (c *Client) ListBranches(project string) (BranchesResponse, error) {
+	query := url.Values{}
+	query.Add("project", project)
+	var response BranchesResponse
+	err := c.GetJSON("/api/project_branches/list", query, &response)
+	return response, err
+}
+
+func (c *Client) Task(id string) (TaskResponse, error) {
+	query := url.Values{}
+	query.Add("id", id)
+	var response TaskResponse
+	err := c.GetJSON("/api/ce/task", query, &response)
+	return response, err
+}
+
+func (c *Client) Measures(component string, branch string, pullRequest string, metrics string) ([]byte, error) {
+	query := url.Values{}
+	query.Add("component", component)
+	AddBranchOrPullRequest(query, branch, pullRequest)
+	query.Add("metricKeys", metrics)
+	return c.Get("/api/measures/component", query)
+}
+
+func (c *Client) MeasuresHistory(component string, branch string, pullRequest string, metrics string, date string) (HistoryResponse, error) {
+	query := url.Values{}
+	query.Add("component", component)
+	AddBranchOrPullRequest(query, branch, pullRequest)
+	query.Add("metrics", metrics)
+	query.Add("from", date)
+	query.Add("to", date)
+	var response HistoryResponse
+	err := c.GetJSON("/api/measures/search_history", query, &response)
+	return response, err
+}
+
+// MeasuresOf returns the measures of the analysis of the version like Measures does.
+// Only the latest analysis has current measures, so older ones are rebuilt from the
+// history, which doesn't know the periods and the values of the new code.
+func (c *Client) MeasuresOf(component string, branch string, pullRequest string, metrics string, version Version) ([]byte, error) {
+	date := version.Date()
+	if date == "" {
+		return c.Measures(component, branch, pullRequest, metrics)
+	}
+	latest, err := c.SearchAnalyses(component, branch, pullRequest, "", 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(latest.Analyses) > 0 && latest.Analyses[0].identifies(version) {
+		return c.Measures(component, branch, pullRequest, metrics)
+	}
+	history, err := c.MeasuresHistory(component, branch, pullRequest, metrics, date)
+	if err != nil {
+		return nil, err
+	}
+	return measuresAt(history, component, date)
+}
+
+// measuresAt picks the values of the analysis at date out of the history
+// and returns them in the format of the current measures.
+func measuresAt(response HistoryResponse, component string, date string) ([]byte, error) {
+	result := MeasuresResponse{Component: MeasuresComponent{Key: component, Measures: []Measure{}}}
+	for _, m := range response.Measures {
+		for _, h := range m.History {
+			if sameDate(h.Date, date) && h.Value != "" {
+				result.Component.Measures = append(result.Component.Measures, Measure{Metric: m.Metric, Value: h.Value})
+				break
+			}
+		}
+	}
+	if len(result.Component.Measures) == 0 {
+		return nil, errors.New("no measures found for analysis at " + date)
+	}
+	return json.Marshal(result)
+}
+
+func sameDate(a string, b string) bool {
+	const layout = "2006-01-02T15:04:05-0700"
+	timeA, errA := time.Parse(layout, a)
+	timeB, errB := time.Parse(layout, b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return timeA.Equal(timeB)
+}
+
+// QualityGate prefers the analysis, as SonarQube doesn't accept it together with a branch or pull request.
+func (c *Client) QualityGate(project string, branch string, pullRequest string, analysis string) ([]byte, error) {
+	query := url.Values{}
+	if analysis != "" {
+		query.Add("analysisId", analysis)
+	} else {
+		query.Add("projectKey", project)
+		AddBranchOrPullRequest(query, branch, pullRequest)
+	}
+	return c.Get("/api/qualitygates/project_status", query)
+}
+
+// SearchIssues pages with the given query, which is left untouched.
+func (c *Client) SearchIssues(query url.Values, page int, pageSize int) (IssuesResponse, error) {
+	var response IssuesResponse
+	err := c.GetJSON("/api/issues/search", paged(query, page, pageSize), &response)
+	return response, err
+}
+
+// SearchRawIssues pages like SearchIssues, but keeps all fields of the issues.
+func (c *Client) SearchRawIssues(query url.Values, page int, pageSize int) (RawIssuesResponse, error) {
+	var response RawIssuesResponse
+	err := c.GetJSON("/api/issues/search", paged(query, page, pageSize), &response)
+	return response, err
+}
+
+func (c *Client) SearchHotspots(query url.Values, page int, pageSize int) (HotspotsResponse, error) {
+	var response HotspotsResponse
+	err := c.GetJSON("/api/hotspots/search", paged(query, page, pageSize), &response)
+	return response, err
+}
+
+func paged(query url.Values, page int, pageSize int) url.Values {
+	parameters := url.Values{}
+	for k, v := range query {
+		parameters[k] = v
+	}
+	parameters.Set("p", strconv.Itoa(page))
+	parameters.Set("ps", strconv.Itoa(pageSize))
+	return parameters
+}
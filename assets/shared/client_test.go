@@ -0,0 +1,318 @@
+package shared_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared/sharedtest"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newClient(t *testing.T, url string) *shared.Client {
+	client, err := shared.NewClient(shared.Source{Target: url, SonarToken: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RetryWait = 0
+	return client
+}
+
+func TestDecodesTypedResponse(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := "/sonar/api/project_analyses/search?branch=main&p=2&project=my%3Acomponent&ps=10"
+		if r.URL.String() != expected {
+			t.Errorf("Expected %v, but got %v", expected, r.URL.String())
+		}
+		if user, password, _ := r.BasicAuth(); user != "token" || password != "" {
+			t.Errorf("Expected token as user, but got %v:%v", user, password)
+		}
+		if _, err := w.Write([]byte(`{"paging":{"total":11},"analyses":[{"key":"AWKa7VV9drIzrRaH-p_z","revision":"61cebf"}]}`)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	response, err := newClient(t, s.URL+"/sonar").SearchAnalyses("my:component", "main", "", "", 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Paging.Total != 11 || len(response.Analyses) != 1 || response.Analyses[0].Version().Analysis() != "AWKa7VV9drIzrRaH-p_z" {
+		t.Errorf("Expected the analysis, but got %+v", response)
+	}
+}
+
+func TestReturnsErrorWithStatusAndBody(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		if _, err := w.Write([]byte(`{"errors":[{"msg":"Component not found"}]}`)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	_, err := newClient(t, s.URL).ListBranches("my:component")
+	sonarErr, ok := err.(*shared.Error)
+	if !ok {
+		t.Fatalf("Expected shared.Error, but got %v", err)
+	}
+	if sonarErr.StatusCode != http.StatusNotFound || sonarErr.Method != http.MethodGet {
+		t.Errorf("Expected 404 of GET, but got %v of %v", sonarErr.StatusCode, sonarErr.Method)
+	}
+	expected := `Status 404 : {"errors":[{"msg":"Component not found"}]}`
+	if err.Error() != expected {
+		t.Errorf("Expected %v, but got %v", expected, err.Error())
+	}
+}
+
+func TestRetriesTemporaryFailures(t *testing.T) {
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if _, err := w.Write([]byte(`{"task":{"id":"AVAn5RKqYwETbXvgas-I","status":"SUCCESS"}}`)); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	response, err := newClient(t, s.URL).Task("AVAn5RKqYwETbXvgas-I")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || response.Task.Status != "SUCCESS" {
+		t.Errorf("Expected success after 3 calls, but got %v after %v", response.Task.Status, calls)
+	}
+}
+
+func TestGivesUpAfterRetries(t *testing.T) {
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer s.Close()
+
+	client := newClient(t, s.URL)
+	client.Retries = 1
+	if _, err := client.Measures("my:component", "", "", "coverage"); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, but got %v", calls)
+	}
+}
+
+func TestDoesNotRetryRefusedConnections(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+
+	client := newClient(t, s.URL)
+	client.RetryWait = time.Minute
+	start := time.Now()
+	if _, err := client.Measures("my:component", "", "", "coverage"); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected no retry, but took %v", elapsed)
+	}
+}
+
+func TestDoesNotRetryPermanentFailuresOrChanges(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		status int
+		call   func(*shared.Client) error
+	}{
+		{"bad request", http.StatusBadRequest, func(c *shared.Client) error {
+			_, err := c.QualityGate("my:component", "", "", "AWKa7VV9drIzrRaH-p_z")
+			return err
+		}},
+		{"event", http.StatusServiceUnavailable, func(c *shared.Client) error {
+			_, err := c.CreateEvent("AWKa7VV9drIzrRaH-p_z", "1.0.0", "VERSION")
+			return err
+		}},
+	} {
+		var calls int
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(c.status)
+		}))
+
+		if err := c.call(newClient(t, s.URL)); err == nil {
+			t.Errorf("Expected error to occure for %v, but didn't", c.name)
+		}
+		if calls != 1 {
+			t.Errorf("Expected 1 call for %v, but got %v", c.name, calls)
+		}
+		s.Close()
+	}
+}
+
+func TestAuthenticatesByMode(t *testing.T) {
+	for _, c := range []struct {
+		source   shared.Source
+		expected string
+	}{
+		{shared.Source{SonarToken: "token"}, "Basic dG9rZW46"},
+		{shared.Source{SonarToken: "token", AuthMode: shared.TokenAuth}, "Basic dG9rZW46"},
+		{shared.Source{SonarToken: "token", AuthMode: shared.BearerAuth}, "Bearer token"},
+		{shared.Source{Username: "admin", Password: "secret", AuthMode: shared.BasicAuth}, "Basic YWRtaW46c2VjcmV0"},
+		{shared.Source{SonarToken: "token", Headers: map[string]string{"Authorization": "Negotiate abc"}}, "Negotiate abc"},
+	} {
+		var auth string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth = r.Header.Get("Authorization")
+			if _, err := w.Write([]byte(`{"branches":[]}`)); err != nil {
+				t.Error(err)
+			}
+		}))
+
+		c.source.Target = s.URL
+		client, err := shared.NewClient(c.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.ListBranches("my:component"); err != nil {
+			t.Error(err)
+		}
+		if auth != c.expected {
+			t.Errorf("Expected %v, but got %v", c.expected, auth)
+		}
+		s.Close()
+	}
+}
+
+func newTLSServer(t *testing.T) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(`{"branches":[{"name":"main"}]}`)); err != nil {
+			t.Error(err)
+		}
+	}))
+}
+
+// newClientCertificate creates a self-signed certificate for authenticating the client.
+func newClientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "concourse"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, sharedtest.CertificatePEM(cert), string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: encodedKey}))
+}
+
+func TestFailsOnUnknownCertificateAuthority(t *testing.T) {
+	s := newTLSServer(t)
+	defer s.Close()
+
+	if _, err := newClient(t, s.URL).ListBranches("my:component"); err == nil {
+		t.Error("Expected error to occure, but didn't")
+	}
+}
+
+func TestTrustsCACertificate(t *testing.T) {
+	s := newTLSServer(t)
+	defer s.Close()
+
+	client, err := shared.NewClient(shared.Source{Target: s.URL, SonarToken: "token", CACert: sharedtest.CertificatePEM(s.Certificate())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListBranches("my:component"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSkipsVerificationWhenInsecure(t *testing.T) {
+	s := newTLSServer(t)
+	defer s.Close()
+
+	client, err := shared.NewClient(shared.Source{Target: s.URL, SonarToken: "token", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListBranches("my:component"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAuthenticatesWithClientCertificate(t *testing.T) {
+	cert, certPEM, keyPEM := newClientCertificate(t)
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "concourse" {
+			t.Error("Expected the client certificate")
+		}
+		if _, err := w.Write([]byte(`{"branches":[]}`)); err != nil {
+			t.Error(err)
+		}
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	s.StartTLS()
+	defer s.Close()
+
+	source := shared.Source{Target: s.URL, SonarToken: "token", CACert: sharedtest.CertificatePEM(s.Certificate())}
+	client, err := shared.NewClient(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListBranches("my:component"); err == nil {
+		t.Error("Expected error without client certificate, but didn't")
+	}
+
+	source.ClientCert, source.ClientKey = certPEM, keyPEM
+	client, err = shared.NewClient(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListBranches("my:component"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestErrorsOnInvalidCertificates(t *testing.T) {
+	_, certPEM, _ := newClientCertificate(t)
+	for _, source := range []shared.Source{
+		{CACert: "not a certificate"},
+		{ClientCert: certPEM},
+		{ClientCert: certPEM, ClientKey: "not a key"},
+	} {
+		if _, err := shared.NewClient(source); err == nil {
+			t.Errorf("Expected error to occure for %+v, but didn't", source)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// Package sharedtest contains helpers for the tests of the resource's binaries.
+package sharedtest
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+)
+
+// CertificatePEM encodes the certificate like it's given as ca_cert or client_cert of the source.
+func CertificatePEM(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
@@ -0,0 +1,181 @@
+package shared
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type AnalysesResponse struct {
+	Paging   Paging     `json:"paging"`
+	Analyses []Analysis `json:"analyses"`
+}
+
+type Analysis struct {
+	Key            string `json:"key"`
+	Date           string `json:"date"`
+	ProjectVersion string `json:"projectVersion"`
+	Revision       string `json:"revision"`
+}
+
+// Version identifies the analysis as a version of the resource.
+func (a Analysis) Version() Version {
+	return NewVersion(a.Key, a.Date, a.ProjectVersion, a.Revision)
+}
+
+// identifies compares the dates of versions emitted before analysis keys were used.
+func (a Analysis) identifies(v Version) bool {
+	if v.Analysis() != "" {
+		return a.Key == v.Analysis()
+	}
+	return sameDate(a.Date, v.Date())
+}
+
+type EventResponse struct {
+	Event Event `json:"event"`
+}
+
+type Event struct {
+	Key      string `json:"key"`
+	Analysis string `json:"analysis"`
+	Category string `json:"category"`
+	Name     string `json:"name"`
+}
+
+type BranchesResponse struct {
+	Branches []ProjectBranch `json:"branches"`
+}
+
+type ProjectBranch struct {
+	Name         string `json:"name"`
+	AnalysisDate string `json:"analysisDate"`
+}
+
+type TaskResponse struct {
+	Task Task `json:"task"`
+}
+
+type Task struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	AnalysisID   string `json:"analysisId"`
+	Branch       string `json:"branch"`
+	PullRequest  string `json:"pullRequest"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+type MeasuresResponse struct {
+	Component MeasuresComponent `json:"component"`
+}
+
+type MeasuresComponent struct {
+	Key      string    `json:"key"`
+	Measures []Measure `json:"measures"`
+}
+
+type Measure struct {
+	Metric  string   `json:"metric"`
+	Value   string   `json:"value"`
+	Period  *Period  `json:"period,omitempty"`
+	Periods []Period `json:"periods,omitempty"`
+}
+
+type Period struct {
+	Index int    `json:"index"`
+	Value string `json:"value"`
+}
+
+// ActualValue falls back to the new code period for new_* metrics, which have no overall value.
+func (m Measure) ActualValue() (string, bool) {
+	if m.Value != "" {
+		return m.Value, true
+	}
+	return m.NewCodeValue()
+}
+
+// NewCodeValue is the value of the new code period, which is a delta for most metrics.
+// Older SonarQube versions report it as the first of the periods.
+func (m Measure) NewCodeValue() (string, bool) {
+	switch {
+	case m.Period != nil:
+		return m.Period.Value, true
+	case len(m.Periods) > 0:
+		return m.Periods[0].Value, true
+	}
+	return "", false
+}
+
+type HistoryResponse struct {
+	Measures []MeasureHistory `json:"measures"`
+}
+
+type MeasureHistory struct {
+	Metric  string         `json:"metric"`
+	History []HistoryEntry `json:"history"`
+}
+
+type HistoryEntry struct {
+	Date  string `json:"date"`
+	Value string `json:"value"`
+}
+
+type QualityGateResponse struct {
+	ProjectStatus ProjectStatus `json:"projectStatus"`
+}
+
+type ProjectStatus struct {
+	Status     string      `json:"status"`
+	Conditions []Condition `json:"conditions"`
+}
+
+type Condition struct {
+	Status           string `json:"status"`
+	MetricKey        string `json:"metricKey"`
+	Comparator       string `json:"comparator"`
+	ErrorThreshold   string `json:"errorThreshold"`
+	WarningThreshold string `json:"warningThreshold"`
+	ActualValue      string `json:"actualValue"`
+}
+
+type IssuesResponse struct {
+	Paging Paging  `json:"paging"`
+	Issues []Issue `json:"issues"`
+}
+
+// RawIssuesResponse keeps the issues as they are, for writing them to a file.
+type RawIssuesResponse struct {
+	Paging Paging            `json:"paging"`
+	Issues []json.RawMessage `json:"issues"`
+}
+
+type HotspotsResponse struct {
+	Paging   Paging            `json:"paging"`
+	Hotspots []json.RawMessage `json:"hotspots"`
+}
+
+type Paging struct {
+	PageIndex int `json:"pageIndex"`
+	PageSize  int `json:"pageSize"`
+	Total     int `json:"total"`
+}
+
+type Issue struct {
+	Key          string     `json:"key"`
+	Component    string     `json:"component"`
+	Line         int        `json:"line"`
+	TextRange    *TextRange `json:"textRange,omitempty"`
+	Message      string     `json:"message"`
+	Severity     string     `json:"severity"`
+	Type         string     `json:"type"`
+	Rule         string     `json:"rule"`
+	CreationDate string     `json:"creationDate"`
+}
+
+type TextRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// Path is the path of the file within the project, as the component is prefixed with the project key.
+func (i Issue) Path(project string) string {
+	return strings.TrimPrefix(i.Component, project+":")
+}
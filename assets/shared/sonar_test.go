@@ -0,0 +1,30 @@
+package shared_test
+
+import (
+	"github.com/elgohr/concourse-sonarqube-notifier/assets/shared"
+	"testing"
+)
+
+func TestReturnsValueOfMeasure(t *testing.T) {
+	m := shared.Measure{Metric: "coverage", Value: "91.2", Periods: []shared.Period{{Index: 1, Value: "40.5"}}}
+	if value, ok := m.ActualValue(); !ok || value != "91.2" {
+		t.Errorf("Expected 91.2, but got %v", value)
+	}
+	if delta, ok := m.NewCodeValue(); !ok || delta != "40.5" {
+		t.Errorf("Expected 40.5, but got %v", delta)
+	}
+}
+
+func TestFallsBackToNewCodeValueOfMeasure(t *testing.T) {
+	m := shared.Measure{Metric: "new_bugs", Period: &shared.Period{Index: 1, Value: "2"}}
+	if value, ok := m.ActualValue(); !ok || value != "2" {
+		t.Errorf("Expected 2, but got %v", value)
+	}
+}
+
+func TestReturnsFalseWhenMeasureHasNoValue(t *testing.T) {
+	m := shared.Measure{Metric: "coverage"}
+	if _, ok := m.ActualValue(); ok {
+		t.Error("Expected no value")
+	}
+}
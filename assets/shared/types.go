@@ -1,17 +1,91 @@
 package shared
 
+// BranchesMode makes check emit the set of analysed branches instead of analyses.
+const BranchesMode = "branches"
+
+// Authentication modes of the source. TokenAuth sends the token as the user of basic authentication.
+const (
+	TokenAuth  = "token"
+	BearerAuth = "bearer"
+	BasicAuth  = "basic"
+)
+
 type Source struct {
-	Target     string `json:"target"`
-	SonarToken string `json:"sonartoken"`
-	Component  string `json:"component"`
-	Metrics    string `json:"metrics"`
+	Target             string            `json:"target"`
+	SonarToken         string            `json:"sonartoken"`
+	Component          string            `json:"component"`
+	Metrics            string            `json:"metrics"`
+	Branch             string            `json:"branch"`
+	PullRequest        string            `json:"pull_request"`
+	Mode               string            `json:"mode"`
+	BranchInclude      string            `json:"branch_include"`
+	BranchExclude      string            `json:"branch_exclude"`
+	PageSize           int               `json:"page_size"`
+	MaxPages           int               `json:"max_pages"`
+	AuthMode           string            `json:"auth_mode"`
+	Username           string            `json:"username"`
+	Password           string            `json:"password"`
+	Headers            map[string]string `json:"headers"`
+	CACert             string            `json:"ca_cert"`
+	ClientCert         string            `json:"client_cert"`
+	ClientKey          string            `json:"client_key"`
+	InsecureSkipVerify bool              `json:"insecure_skip_verify"`
 }
 
 func (s *Source) Valid() bool {
 	return len(s.Component) != 0 &&
-		len(s.Metrics) != 0 &&
+		(len(s.Metrics) != 0 || s.Mode == BranchesMode) &&
 		len(s.Target) != 0 &&
-		len(s.SonarToken) != 0
+		s.hasCredentials()
+}
+
+func (s *Source) hasCredentials() bool {
+	if s.AuthMode == BasicAuth {
+		return len(s.Username) != 0
+	}
+	return len(s.SonarToken) != 0
 }
 
+// Version identifies a single SonarQube analysis by its key.
 type Version map[string]string
+
+func NewVersion(analysis string, date string, projectVersion string, revision string) Version {
+	v := Version{"analysis": analysis}
+	if date != "" {
+		v["date"] = date
+	}
+	if projectVersion != "" {
+		v["project_version"] = projectVersion
+	}
+	if revision != "" {
+		v["revision"] = revision
+	}
+	return v
+}
+
+func (v Version) Analysis() string {
+	return v["analysis"]
+}
+
+// Date falls back to the timestamp of versions emitted before analysis keys were used.
+func (v Version) Date() string {
+	if date, ok := v["date"]; ok {
+		return date
+	}
+	return v["timestamp"]
+}
+
+func (v Version) Metadata() []MetadataField {
+	var metadata []MetadataField
+	for _, name := range []string{"analysis", "date", "project_version", "revision"} {
+		if value, ok := v[name]; ok {
+			metadata = append(metadata, MetadataField{Name: name, Value: value})
+		}
+	}
+	return metadata
+}
+
+type MetadataField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
@@ -17,6 +17,32 @@ func TestReturnsTrueWhenAllFieldsAreFilled(t *testing.T) {
 	}
 }
 
+func TestReturnsTrueWhenUsernameReplacesSonarToken(t *testing.T) {
+	src := shared.Source{
+		Target:    "Target",
+		Metrics:   "Metrics",
+		Component: "Component",
+		AuthMode:  shared.BasicAuth,
+		Username:  "Username",
+	}
+	if !src.Valid() {
+		t.Error("Wasn't valid")
+	}
+}
+
+func TestReturnsFalseWhenUsernameIsMissing(t *testing.T) {
+	src := shared.Source{
+		Target:     "Target",
+		SonarToken: "Token",
+		Metrics:    "Metrics",
+		Component:  "Component",
+		AuthMode:   shared.BasicAuth,
+	}
+	if src.Valid() {
+		t.Error("Is still valid")
+	}
+}
+
 func TestReturnsFalseWhenTargetIsMissing(t *testing.T) {
 	src := shared.Source{
 		Target: "",
@@ -53,6 +79,18 @@ func TestReturnsFalseWhenMetricsIsMissing(t *testing.T) {
 	}
 }
 
+func TestReturnsTrueWhenMetricsIsMissingInBranchesMode(t *testing.T) {
+	src := shared.Source{
+		Target:     "Target",
+		SonarToken: "Token",
+		Component:  "Component",
+		Mode:       shared.BranchesMode,
+	}
+	if !src.Valid() {
+		t.Error("Wasn't valid")
+	}
+}
+
 func TestReturnsFalseWhenComponentIsMissing(t *testing.T) {
 	src := shared.Source{
 		Target: "Target",
@@ -64,3 +102,45 @@ func TestReturnsFalseWhenComponentIsMissing(t *testing.T) {
 		t.Error("Is still valid")
 	}
 }
+
+func TestCreatesVersionWithoutEmptyFields(t *testing.T) {
+	v := shared.NewVersion("AWKa7VV9drIzrRaH-p_z", "2018-04-06T14:27:06+0200", "", "61cebf")
+	if len(v) != 3 {
+		t.Errorf("Expected 3 fields, but got %v", v)
+	}
+	if v.Analysis() != "AWKa7VV9drIzrRaH-p_z" {
+		t.Errorf("Expected analysis key, but got %v", v.Analysis())
+	}
+	if v.Date() != "2018-04-06T14:27:06+0200" {
+		t.Errorf("Expected date, but got %v", v.Date())
+	}
+	if _, ok := v["project_version"]; ok {
+		t.Error("Expected empty project version to be omitted")
+	}
+}
+
+func TestReadsDateOfTimestampVersions(t *testing.T) {
+	v := shared.Version{"timestamp": "2018-04-06T14:27:06+0200"}
+	if v.Date() != "2018-04-06T14:27:06+0200" {
+		t.Errorf("Expected timestamp as date, but got %v", v.Date())
+	}
+}
+
+func TestReturnsMetadataInStableOrder(t *testing.T) {
+	v := shared.NewVersion("key", "date", "1.0.0", "61cebf")
+	metadata := v.Metadata()
+	expected := []shared.MetadataField{
+		{Name: "analysis", Value: "key"},
+		{Name: "date", Value: "date"},
+		{Name: "project_version", Value: "1.0.0"},
+		{Name: "revision", Value: "61cebf"},
+	}
+	if len(metadata) != len(expected) {
+		t.Fatalf("Expected %v, but got %v", expected, metadata)
+	}
+	for i := range expected {
+		if metadata[i] != expected[i] {
+			t.Errorf("Expected %v, but got %v", expected[i], metadata[i])
+		}
+	}
+}